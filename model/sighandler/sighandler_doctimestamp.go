@@ -0,0 +1,173 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/xwc1125/gopdf/core"
+	"github.com/xwc1125/gopdf/model"
+)
+
+// docTimeStamp is a signature handler for an ETSI.RFC3161 /DocTimeStamp signature field.
+// Unlike the other handlers it does not sign anything itself; the Contents field is a
+// pre-computed RFC 3161 TimeStampToken obtained from a TSA.
+type docTimeStamp struct {
+	token []byte
+	roots *x509.CertPool
+
+	emptySignature    bool
+	emptySignatureLen int
+}
+
+// NewEmptyDocTimeStamp creates a new ETSI.RFC3161 /DocTimeStamp handler producing an empty
+// signature of size signatureLen, for use when only the Contents field size needs to be
+// reserved.
+func NewEmptyDocTimeStamp(signatureLen int) (model.SignatureHandler, error) {
+	return &docTimeStamp{
+		emptySignature:    true,
+		emptySignatureLen: signatureLen,
+	}, nil
+}
+
+// NewDocTimeStamp creates a new ETSI.RFC3161 /DocTimeStamp handler embedding the given
+// RFC 3161 TimeStampToken (a ContentInfo of type id-signedData) as the signature Contents.
+// Validate verifies that token's signature chains to roots; pass nil only if the caller
+// intends to trust any self-consistent token regardless of who issued it, which disables
+// certificate verification entirely (see TSAClient.Validate).
+func NewDocTimeStamp(token []byte, roots *x509.CertPool) (model.SignatureHandler, error) {
+	return &docTimeStamp{token: token, roots: roots}, nil
+}
+
+// InitSignature initialises the PdfSignature.
+func (d *docTimeStamp) InitSignature(sig *model.PdfSignature) error {
+	if !d.emptySignature && len(d.token) == 0 {
+		return errors.New("timestamp token must not be empty")
+	}
+
+	handler := *d
+	sig.Handler = &handler
+	sig.Type = core.MakeName("DocTimeStamp")
+	sig.Filter = core.MakeName("Adobe.PPKLite")
+	sig.SubFilter = core.MakeName("ETSI.RFC3161")
+	sig.Reference = nil
+
+	digest, err := handler.NewDigest(sig)
+	if err != nil {
+		return err
+	}
+	return handler.Sign(sig, digest)
+}
+
+// NewDigest creates a new digest.
+func (d *docTimeStamp) NewDigest(sig *model.PdfSignature) (model.Hasher, error) {
+	return bytes.NewBuffer(nil), nil
+}
+
+// Validate validates PdfSignature. The token embedded in Contents must chain to d.roots
+// and its message imprint must match the /ByteRange-covered document bytes written into
+// digest by the caller, the same consultation of the time-stamp chain TSAClient.Validate
+// performs for a timestamp covering another signature (see sighandler_tsa.go).
+func (d *docTimeStamp) Validate(sig *model.PdfSignature, digest model.Hasher) (model.SignatureValidationResult, error) {
+	token := sig.Contents.Bytes()
+	if len(token) == 0 {
+		return model.SignatureValidationResult{}, errors.New("sighandler: empty DocTimeStamp contents")
+	}
+
+	buffer := digest.(*bytes.Buffer)
+	if err := validateTimestampToken(token, buffer.Bytes(), d.roots); err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	return model.SignatureValidationResult{
+		IsSigned:   true,
+		IsVerified: true,
+	}, nil
+}
+
+// Sign sets the Contents field to the pre-computed timestamp token.
+func (d *docTimeStamp) Sign(sig *model.PdfSignature, digest model.Hasher) error {
+	if d.emptySignature {
+		sigLen := d.emptySignatureLen
+		if sigLen <= 0 {
+			sigLen = 8192
+		}
+		sig.Contents = core.MakeHexString(string(make([]byte, sigLen)))
+		return nil
+	}
+
+	data := make([]byte, 8192)
+	if len(d.token) > len(data) {
+		return fmt.Errorf("sighandler: timestamp token is %d bytes, exceeds the %d byte Contents reservation", len(d.token), len(data))
+	}
+	copy(data, d.token)
+	sig.Contents = core.MakeHexString(string(data))
+	return nil
+}
+
+// IsApplicable returns true if the signature handler is applicable for the PdfSignature.
+func (d *docTimeStamp) IsApplicable(sig *model.PdfSignature) bool {
+	if sig == nil || sig.Filter == nil || sig.SubFilter == nil {
+		return false
+	}
+	return (*sig.Filter == "Adobe.PPKMS" || *sig.Filter == "Adobe.PPKLite") && *sig.SubFilter == "ETSI.RFC3161"
+}
+
+// BuildDSS builds a document security store (/DSS) dictionary (ISO 32000-2, 12.8.4.3)
+// embedding the certificates, OCSP responses and CRLs collected while signing, so that
+// PAdES B-LT/B-LTA signatures can be validated without contacting external services. Use
+// FetchRevocationInfo (sighandler_ltv.go) to collect ocsps/crls for a signer's certificate
+// chain; certs should hold the DER encoding of every certificate in that same chain. The
+// caller is responsible for attaching the returned dictionary to the document catalog's
+// /DSS entry: adobePAdESLTV.Validate only checks the embedded RevocationInfoArchival
+// attribute, which is sufficient to validate that one signature on its own. Call
+// sighandler.ValidateDSS (sighandler_ltv.go) alongside it to additionally cross-check a
+// signature against the document-wide /DSS store, e.g. for a B-LTA signature covering
+// several prior signatures.
+func BuildDSS(certs, ocsps, crls [][]byte) (*core.PdfObjectDictionary, error) {
+	dss := core.MakeDict()
+
+	certArr, err := rawStreamsToArray(certs)
+	if err != nil {
+		return nil, err
+	}
+	ocspArr, err := rawStreamsToArray(ocsps)
+	if err != nil {
+		return nil, err
+	}
+	crlArr, err := rawStreamsToArray(crls)
+	if err != nil {
+		return nil, err
+	}
+
+	if certArr.Len() > 0 {
+		dss.Set("Certs", certArr)
+	}
+	if ocspArr.Len() > 0 {
+		dss.Set("OCSPs", ocspArr)
+	}
+	if crlArr.Len() > 0 {
+		dss.Set("CRLs", crlArr)
+	}
+	return dss, nil
+}
+
+// rawStreamsToArray wraps each raw byte slice as an uncompressed stream object and
+// returns them as a PdfObjectArray, suitable for /DSS's /Certs, /OCSPs and /CRLs entries.
+func rawStreamsToArray(items [][]byte) (*core.PdfObjectArray, error) {
+	arr := core.MakeArray()
+	for _, item := range items {
+		stream, err := core.MakeStream(item, core.NewRawEncoder())
+		if err != nil {
+			return nil, err
+		}
+		arr.Append(stream)
+	}
+	return arr, nil
+}
@@ -9,15 +9,19 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/x509"
+	"encoding/asn1"
 	"errors"
-	"github.com/gunnsth/pkcs7"
+	"fmt"
+
+	"github.com/digitorus/pkcs7"
+
 	"github.com/xwc1125/gopdf/core"
 	"github.com/xwc1125/gopdf/model"
 )
 
 // Adobe ECC detached signature handler.
 type adobeECCDetached struct {
-	privateKey  *ecdsa.PrivateKey
+	signer      model.Signer
 	certificate *x509.Certificate
 
 	emptySignature    bool
@@ -34,13 +38,20 @@ func NewEmptyAdobeECCDetached(signatureLen int) (model.SignatureHandler, error)
 	}, nil
 }
 
-// NewAdobeECCDetached creates a new Adobe.PPKMS/Adobe.PPKLite adbe.ECC.detached signature handler.
-// Both parameters may be nil for the signature validation.
-func NewAdobeECCDetached(privateKey *ecdsa.PrivateKey, certificate *x509.Certificate) (model.SignatureHandler, error) {
-	return &adobeECCDetached{
-		certificate: certificate,
-		privateKey:  privateKey,
-	}, nil
+// NewAdobeECCDetached creates a new Adobe.PPKMS/Adobe.PPKLite adbe.ECC.detached signature
+// handler backed by signer, whose key must be an ECDSA key. signer may be nil for
+// signature validation.
+func NewAdobeECCDetached(signer model.Signer) (model.SignatureHandler, error) {
+	if signer != nil {
+		if _, ok := signer.Public().(*ecdsa.PublicKey); !ok {
+			return nil, fmt.Errorf("sighandler: signer must hold an ECDSA key, got %T", signer.Public())
+		}
+	}
+	handler := &adobeECCDetached{signer: signer}
+	if signer != nil {
+		handler.certificate = signer.Certificate()
+	}
+	return handler, nil
 }
 
 // InitSignature initialises the PdfSignature.
@@ -49,8 +60,8 @@ func (a *adobeECCDetached) InitSignature(sig *model.PdfSignature) error {
 		if a.certificate == nil {
 			return errors.New("certificate must not be nil")
 		}
-		if a.privateKey == nil {
-			return errors.New("privateKey must not be nil")
+		if a.signer == nil {
+			return errors.New("signer must not be nil")
 		}
 	}
 
@@ -125,7 +136,7 @@ func (a *adobeECCDetached) Sign(sig *model.PdfSignature, digest model.Hasher) er
 	}
 
 	// Add the signing cert and private key
-	if err := signedData.AddSigner(a.certificate, a.privateKey, pkcs7.SignerInfoConfig{}); err != nil {
+	if err := signedData.AddSignerChain(a.certificate, a.signer, a.signer.Chain(), pkcs7.SignerInfoConfig{}); err != nil {
 		return err
 	}
 
@@ -139,7 +150,10 @@ func (a *adobeECCDetached) Sign(sig *model.PdfSignature, digest model.Hasher) er
 	}
 
 	//data := make([]byte, 8192)
-	data := make([]byte, 8192 * 2 + 2)
+	data := make([]byte, 8192*2+2)
+	if len(detachedSignature) > len(data) {
+		return fmt.Errorf("sighandler: signature is %d bytes, exceeds the %d byte Contents reservation", len(detachedSignature), len(data))
+	}
 	copy(data, detachedSignature)
 
 	// contents=8192 * 2 + 2
@@ -147,10 +161,56 @@ func (a *adobeECCDetached) Sign(sig *model.PdfSignature, digest model.Hasher) er
 	return nil
 }
 
-// IsApplicable returns true if the signature handler is applicable for the PdfSignature
+// IsApplicable returns true if the signature handler is applicable for the PdfSignature.
+// Several handlers in this package share the Adobe.PPKLite/ETSI.CAdES.detached
+// Filter/SubFilter pair, so a plain approval signature is only recognised here if it
+// carries none of the unsigned attributes that identify the richer variants (PAdES B-LT's
+// RevocationInfoArchival and the RFC 3161 timestamp token); otherwise the caller's first
+// matching handler in ValidateSignatures would silently skip those checks.
 func (a *adobeECCDetached) IsApplicable(sig *model.PdfSignature) bool {
 	if sig == nil || sig.Filter == nil || sig.SubFilter == nil {
 		return false
 	}
-	return (*sig.Filter == "Adobe.PPKMS" || *sig.Filter == "Adobe.PPKLite") && *sig.SubFilter == "ETSI.CAdES.detached"
+	if !((*sig.Filter == "Adobe.PPKMS" || *sig.Filter == "Adobe.PPKLite") && *sig.SubFilter == "ETSI.CAdES.detached") {
+		return false
+	}
+	if hasUnauthenticatedAttribute(sig, oidRevocationInfoArchival) || hasUnauthenticatedAttribute(sig, oidSignatureTimeStampToken) {
+		return false
+	}
+	oid := signingAlgorithmOID(sig)
+	return oid == nil || (!oid.Equal(oidEncryptionAlgorithmRSASSAPSS) && !oid.Equal(pkcs7.OIDEncryptionAlgorithmEDDSA25519))
+}
+
+// signingAlgorithmOID returns the DigestEncryptionAlgorithm OID of the first signer found
+// in sig's CMS Contents, or nil if Contents is absent or cannot be parsed (e.g. because it
+// is still an empty byte-range placeholder). It is used by IsApplicable to tell apart the
+// several handlers in this package that share the same Filter/SubFilter pair.
+func signingAlgorithmOID(sig *model.PdfSignature) asn1.ObjectIdentifier {
+	if sig.Contents == nil {
+		return nil
+	}
+	p7, err := pkcs7.Parse(sig.Contents.Bytes())
+	if err != nil || len(p7.Signers) == 0 {
+		return nil
+	}
+	return p7.Signers[0].DigestEncryptionAlgorithm.Algorithm
+}
+
+// hasUnauthenticatedAttribute reports whether the first signer found in sig's CMS Contents
+// carries an unsigned attribute with the given OID. It returns false, rather than erroring,
+// if Contents is absent or cannot be parsed, since IsApplicable has no way to report errors.
+func hasUnauthenticatedAttribute(sig *model.PdfSignature, oid asn1.ObjectIdentifier) bool {
+	if sig.Contents == nil {
+		return false
+	}
+	p7, err := pkcs7.Parse(sig.Contents.Bytes())
+	if err != nil || len(p7.Signers) == 0 {
+		return false
+	}
+	for _, attr := range p7.Signers[0].UnauthenticatedAttributes {
+		if attr.Type.Equal(oid) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,168 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/digitorus/pkcs7"
+
+	"github.com/xwc1125/gopdf/core"
+	"github.com/xwc1125/gopdf/model"
+)
+
+// adobeEd25519Detached is an Adobe.PPKLite adbe.CAdES.detached signature handler that
+// signs with Ed25519 (RFC 8410), using pkcs7's built-in support for pure Ed25519 signing.
+// Per RFC 8419, the CMS digest algorithm is fixed to SHA-512, although the signature
+// itself is computed over the signed attributes directly rather than over their hash.
+type adobeEd25519Detached struct {
+	signer      model.Signer
+	certificate *x509.Certificate
+
+	emptySignature    bool
+	emptySignatureLen int
+}
+
+// NewEmptyAdobeEd25519Detached creates a new Adobe.PPKLite adbe.CAdES.detached Ed25519
+// signature handler producing an empty signature of size signatureLen, for use when only
+// the Contents field size needs to be reserved.
+func NewEmptyAdobeEd25519Detached(signatureLen int) (model.SignatureHandler, error) {
+	return &adobeEd25519Detached{
+		emptySignature:    true,
+		emptySignatureLen: signatureLen,
+	}, nil
+}
+
+// NewAdobeEd25519Detached creates a new Adobe.PPKLite adbe.CAdES.detached signature
+// handler backed by signer, whose key must be an Ed25519 key.
+func NewAdobeEd25519Detached(signer model.Signer) (model.SignatureHandler, error) {
+	if signer != nil {
+		if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("sighandler: signer must hold an Ed25519 key, got %T", signer.Public())
+		}
+	}
+	handler := &adobeEd25519Detached{signer: signer}
+	if signer != nil {
+		handler.certificate = signer.Certificate()
+	}
+	return handler, nil
+}
+
+// InitSignature initialises the PdfSignature.
+func (a *adobeEd25519Detached) InitSignature(sig *model.PdfSignature) error {
+	if !a.emptySignature {
+		if a.certificate == nil {
+			return errors.New("certificate must not be nil")
+		}
+		if a.signer == nil {
+			return errors.New("signer must not be nil")
+		}
+	}
+
+	handler := *a
+	sig.Handler = &handler
+	sig.Filter = core.MakeName("Adobe.PPKLite")
+	sig.SubFilter = core.MakeName("ETSI.CAdES.detached")
+	sig.Reference = nil
+
+	digest, err := handler.NewDigest(sig)
+	if err != nil {
+		return err
+	}
+	digest.Write([]byte("calculate the Contents field size"))
+	return handler.Sign(sig, digest)
+}
+
+// NewDigest creates a new digest.
+func (a *adobeEd25519Detached) NewDigest(sig *model.PdfSignature) (model.Hasher, error) {
+	return bytes.NewBuffer(nil), nil
+}
+
+// Validate validates PdfSignature.
+func (a *adobeEd25519Detached) Validate(sig *model.PdfSignature, digest model.Hasher) (model.SignatureValidationResult, error) {
+	signed := sig.Contents.Bytes()
+	p7, err := pkcs7.Parse(signed)
+	if err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+	if len(p7.Signers) == 0 {
+		return model.SignatureValidationResult{}, errors.New("sighandler: no signers found")
+	}
+	if !p7.Signers[0].DigestEncryptionAlgorithm.Algorithm.Equal(pkcs7.OIDEncryptionAlgorithmEDDSA25519) {
+		return model.SignatureValidationResult{}, fmt.Errorf("sighandler: expected id-Ed25519 signature, got %v", p7.Signers[0].DigestEncryptionAlgorithm.Algorithm)
+	}
+
+	buffer := digest.(*bytes.Buffer)
+	p7.Content = buffer.Bytes()
+	if err = p7.Verify(); err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	return model.SignatureValidationResult{
+		IsSigned:   true,
+		IsVerified: true,
+	}, nil
+}
+
+// Sign sets the Contents field.
+func (a *adobeEd25519Detached) Sign(sig *model.PdfSignature, digest model.Hasher) error {
+	if a.emptySignature {
+		sigLen := a.emptySignatureLen
+		if sigLen <= 0 {
+			sigLen = 8192
+		}
+
+		sig.Contents = core.MakeHexString(string(make([]byte, sigLen)))
+		return nil
+	}
+
+	buffer := digest.(*bytes.Buffer)
+	signedData, err := pkcs7.NewSignedData(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	// RFC 8419 fixes the CMS digest algorithm to SHA-512 for Ed25519 signers; pkcs7 signs
+	// the signed attributes themselves (rather than their hash) once it sees the signer's
+	// public key is an ed25519.PublicKey, regardless of this setting.
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA512)
+	if err := signedData.AddSignerChain(a.certificate, a.signer, a.signer.Chain(), pkcs7.SignerInfoConfig{}); err != nil {
+		return err
+	}
+
+	signedData.Detach()
+	detachedSignature, err := signedData.Finish()
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 8192*2+2)
+	if len(detachedSignature) > len(data) {
+		return fmt.Errorf("sighandler: signature is %d bytes, exceeds the %d byte Contents reservation", len(detachedSignature), len(data))
+	}
+	copy(data, detachedSignature)
+
+	sig.Contents = core.MakeHexString(string(data))
+	return nil
+}
+
+// IsApplicable returns true if the signature handler is applicable for the PdfSignature.
+// Besides the Filter/SubFilter pair it shares with the other CAdES.detached handlers in
+// this package, this handler is only recognised by its id-Ed25519 DigestEncryptionAlgorithm,
+// which no other handler in this package produces.
+func (a *adobeEd25519Detached) IsApplicable(sig *model.PdfSignature) bool {
+	if sig == nil || sig.Filter == nil || sig.SubFilter == nil {
+		return false
+	}
+	if !((*sig.Filter == "Adobe.PPKMS" || *sig.Filter == "Adobe.PPKLite") && *sig.SubFilter == "ETSI.CAdES.detached") {
+		return false
+	}
+	oid := signingAlgorithmOID(sig)
+	return oid != nil && oid.Equal(pkcs7.OIDEncryptionAlgorithmEDDSA25519)
+}
@@ -0,0 +1,102 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/digitorus/pkcs7"
+
+	"github.com/xwc1125/gopdf/model/signer"
+)
+
+func TestAdobeEd25519DetachedSignAndValidate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating Ed25519 key: %v", err)
+	}
+	cert := selfSignedCert(t, pub, priv)
+
+	handler, err := NewAdobeEd25519Detached(signer.NewKMSSigner(priv, cert, nil))
+	if err != nil {
+		t.Fatalf("NewAdobeEd25519Detached: %v", err)
+	}
+
+	sig := signAndValidate(t, handler)
+
+	p7, err := pkcs7.Parse(sig.Contents.Bytes())
+	if err != nil {
+		t.Fatalf("parsing emitted CMS: %v", err)
+	}
+	if len(p7.Signers) != 1 {
+		t.Fatalf("got %d signers, want 1", len(p7.Signers))
+	}
+	if !p7.Signers[0].DigestEncryptionAlgorithm.Algorithm.Equal(pkcs7.OIDEncryptionAlgorithmEDDSA25519) {
+		t.Fatalf("DigestEncryptionAlgorithm = %v, want id-Ed25519 (%v)", p7.Signers[0].DigestEncryptionAlgorithm.Algorithm, pkcs7.OIDEncryptionAlgorithmEDDSA25519)
+	}
+
+	if !handler.IsApplicable(sig) {
+		t.Error("adobeEd25519Detached.IsApplicable returned false for its own signature")
+	}
+}
+
+func TestAdobeEd25519DetachedSignAndValidateWithChain(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating Ed25519 key: %v", err)
+	}
+	leaf, chain, _ := leafCertWithIssuer(t, pub, priv)
+
+	handler, err := NewAdobeEd25519Detached(signer.NewKMSSigner(priv, leaf, chain))
+	if err != nil {
+		t.Fatalf("NewAdobeEd25519Detached: %v", err)
+	}
+	sig := signAndValidate(t, handler)
+
+	p7, err := pkcs7.Parse(sig.Contents.Bytes())
+	if err != nil {
+		t.Fatalf("parsing emitted CMS: %v", err)
+	}
+	if len(p7.Certificates) < 2 {
+		t.Fatalf("emitted CMS carries %d certificates, want at least 2 (leaf + issuer)", len(p7.Certificates))
+	}
+	var foundIssuer bool
+	for _, cert := range p7.Certificates {
+		if cert.Equal(chain[0]) {
+			foundIssuer = true
+		}
+	}
+	if !foundIssuer {
+		t.Error("emitted CMS does not carry the signer's issuer certificate")
+	}
+}
+
+// wrongKeySigner implements model.Signer but reports a non-Ed25519 public key, letting us
+// exercise NewAdobeEd25519Detached's key-type check without a second real key pair.
+type wrongKeySigner struct{}
+
+func (wrongKeySigner) Public() crypto.PublicKey { return &rsa.PublicKey{} }
+
+func (wrongKeySigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("wrongKeySigner cannot sign")
+}
+
+func (wrongKeySigner) Certificate() *x509.Certificate { return nil }
+
+func (wrongKeySigner) Chain() []*x509.Certificate { return nil }
+
+func TestNewAdobeEd25519DetachedRejectsNonEd25519Signer(t *testing.T) {
+	if _, err := NewAdobeEd25519Detached(wrongKeySigner{}); err == nil {
+		t.Fatal("NewAdobeEd25519Detached did not reject a non-Ed25519 signer")
+	}
+}
@@ -0,0 +1,483 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/digitorus/pkcs7"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/xwc1125/gopdf/core"
+	"github.com/xwc1125/gopdf/model"
+)
+
+// oidRevocationInfoArchival is the CAdES/ESS unsigned attribute OID used to embed OCSP
+// responses and CRLs in a SignedData so that the signature can be validated long after
+// the signing certificate has expired or been revoked (PAdES B-LT / B-LTA).
+var oidRevocationInfoArchival = asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}
+
+// revocationInfoArchival mirrors the RevocationInfoArchival ASN.1 structure used by
+// Adobe/ETSI to carry revocation material as an unsigned CMS attribute.
+type revocationInfoArchival struct {
+	CRLs         []asn1.RawValue `asn1:"explicit,optional,tag:0"`
+	OCSPs        []asn1.RawValue `asn1:"explicit,optional,tag:1"`
+	OtherRevInfo []asn1.RawValue `asn1:"explicit,optional,tag:2"`
+}
+
+// RevocationFetcher retrieves OCSP responses and CRLs for a signer's certificate chain
+// so that they can be embedded for long-term validation (LTV).
+type RevocationFetcher interface {
+	// FetchOCSP returns a DER encoded OCSPResponse for leaf, issued by issuer. It returns
+	// a nil slice (without error) if leaf does not advertise an OCSP responder.
+	FetchOCSP(leaf, issuer *x509.Certificate) ([]byte, error)
+	// FetchCRL returns a DER encoded CertificateList covering leaf. It returns a nil
+	// slice (without error) if leaf does not advertise a CRL distribution point.
+	FetchCRL(leaf *x509.Certificate) ([]byte, error)
+}
+
+// httpRevocationFetcher is the default RevocationFetcher, fetching OCSP responses and
+// CRLs over HTTP from the locations advertised in the certificate's AIA/CRLDP extensions.
+type httpRevocationFetcher struct {
+	client *http.Client
+}
+
+// NewHTTPRevocationFetcher returns a RevocationFetcher that talks to OCSP responders
+// and CRL distribution points over HTTP using client. If client is nil, http.DefaultClient
+// is used.
+func NewHTTPRevocationFetcher(client *http.Client) RevocationFetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpRevocationFetcher{client: client}
+}
+
+// FetchOCSP implements RevocationFetcher.
+func (f *httpRevocationFetcher) FetchOCSP(leaf, issuer *x509.Certificate) ([]byte, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ocsp responder %s returned status %d", leaf.OCSPServer[0], resp.StatusCode)
+	}
+
+	// Validate that the responder returned something we can parse before embedding it.
+	if _, err := ocsp.ParseResponseForCert(body, leaf, issuer); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// FetchCRL implements RevocationFetcher.
+func (f *httpRevocationFetcher) FetchCRL(leaf *x509.Certificate) ([]byte, error) {
+	if len(leaf.CRLDistributionPoints) == 0 {
+		return nil, nil
+	}
+
+	var lastErr error
+	for _, dp := range leaf.CRLDistributionPoints {
+		if !strings.HasPrefix(dp, "http://") && !strings.HasPrefix(dp, "https://") {
+			continue
+		}
+
+		resp, err := f.client.Get(dp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("crl distribution point %s returned status %d", dp, resp.StatusCode)
+			continue
+		}
+		if _, err := x509.ParseCRL(body); err != nil {
+			lastErr = err
+			continue
+		}
+		return body, nil
+	}
+	return nil, lastErr
+}
+
+// adobePAdESLTV is a PAdES B-LT/B-LTA signature handler. It produces an ETSI.CAdES.detached
+// signature like adobeECCDetached, but additionally embeds the OCSP responses and CRLs
+// needed to validate the signature after the signing certificate expires.
+type adobePAdESLTV struct {
+	signer      model.Signer
+	certificate *x509.Certificate
+	chain       []*x509.Certificate
+
+	revocationFetcher RevocationFetcher
+
+	emptySignature    bool
+	emptySignatureLen int
+}
+
+// NewEmptyPAdESLTV creates a new PAdES B-LT signature handler producing an empty signature
+// of size signatureLen, for use when only the Contents field size needs to be reserved.
+func NewEmptyPAdESLTV(signatureLen int) (model.SignatureHandler, error) {
+	return &adobePAdESLTV{
+		emptySignature:    true,
+		emptySignatureLen: signatureLen,
+	}, nil
+}
+
+// NewPAdESLTV creates a new PAdES B-LT/B-LTA signature handler backed by signer. The
+// issuer chain returned by signer.Chain() is used both to build the CMS certificate set
+// and to fetch revocation information for every certificate in the path. If fetcher is
+// nil, a default HTTP based fetcher is used.
+func NewPAdESLTV(signer model.Signer, fetcher RevocationFetcher) (model.SignatureHandler, error) {
+	if fetcher == nil {
+		fetcher = NewHTTPRevocationFetcher(nil)
+	}
+	handler := &adobePAdESLTV{
+		signer:            signer,
+		revocationFetcher: fetcher,
+	}
+	if signer != nil {
+		handler.certificate = signer.Certificate()
+		handler.chain = signer.Chain()
+	}
+	return handler, nil
+}
+
+// InitSignature initialises the PdfSignature.
+func (a *adobePAdESLTV) InitSignature(sig *model.PdfSignature) error {
+	if !a.emptySignature {
+		if a.certificate == nil {
+			return errors.New("certificate must not be nil")
+		}
+		if a.signer == nil {
+			return errors.New("signer must not be nil")
+		}
+	}
+
+	handler := *a
+	sig.Handler = &handler
+	sig.Filter = core.MakeName("Adobe.PPKLite")
+	sig.SubFilter = core.MakeName("ETSI.CAdES.detached")
+	sig.Reference = nil
+
+	digest, err := handler.NewDigest(sig)
+	if err != nil {
+		return err
+	}
+	digest.Write([]byte("calculate the Contents field size"))
+	return handler.Sign(sig, digest)
+}
+
+func (a *adobePAdESLTV) getCertificate(sig *model.PdfSignature) (*x509.Certificate, error) {
+	certificate := a.certificate
+	if certificate == nil {
+		certData := sig.Cert.(*core.PdfObjectString).Bytes()
+		certs, err := x509.ParseCertificates(certData)
+		if err != nil {
+			return nil, err
+		}
+		certificate = certs[0]
+	}
+	return certificate, nil
+}
+
+// NewDigest creates a new digest.
+func (a *adobePAdESLTV) NewDigest(sig *model.PdfSignature) (model.Hasher, error) {
+	return bytes.NewBuffer(nil), nil
+}
+
+// FetchRevocationInfo fetches an OCSP response (preferred) or, failing that, a CRL for
+// every certificate in chain (leaf first) using fetcher. The returned byte slices are the
+// same revocation material that both adobePAdESLTV's RevocationInfoArchival unsigned
+// attribute and a /DSS dictionary (see BuildDSS) are built from, so that a caller wanting
+// to populate the document catalog's /DSS entry alongside a PAdES B-LT/B-LTA signature does
+// not need to re-implement the fetch logic:
+//
+//	ocsps, crls, err := sighandler.FetchRevocationInfo(fetcher, chain)
+//	dss, err := sighandler.BuildDSS(certsDER, ocsps, crls)
+//	// attach dss to the document catalog's /DSS entry.
+func FetchRevocationInfo(fetcher RevocationFetcher, chain []*x509.Certificate) (ocsps, crls [][]byte, err error) {
+	for i, cert := range chain {
+		var issuer *x509.Certificate
+		if i+1 < len(chain) {
+			issuer = chain[i+1]
+		} else {
+			issuer = cert
+		}
+
+		ocspResp, err := fetcher.FetchOCSP(cert, issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ocspResp != nil {
+			ocsps = append(ocsps, ocspResp)
+			continue
+		}
+
+		crl, err := fetcher.FetchCRL(cert)
+		if err != nil {
+			return nil, nil, err
+		}
+		if crl != nil {
+			crls = append(crls, crl)
+		}
+	}
+	return ocsps, crls, nil
+}
+
+// buildRevocationInfoArchival fetches OCSP responses and CRLs for the signer's
+// certificate chain (via FetchRevocationInfo) and returns the RevocationInfoArchival
+// attribute value.
+func (a *adobePAdESLTV) buildRevocationInfoArchival() (asn1.RawValue, error) {
+	chain := append([]*x509.Certificate{a.certificate}, a.chain...)
+	ocsps, crls, err := FetchRevocationInfo(a.revocationFetcher, chain)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	if len(ocsps) == 0 && len(crls) == 0 {
+		return asn1.RawValue{}, errors.New("sighandler: no revocation information could be retrieved for the signer chain")
+	}
+
+	archival := revocationInfoArchival{}
+	for _, ocspResp := range ocsps {
+		archival.OCSPs = append(archival.OCSPs, asn1.RawValue{FullBytes: ocspResp})
+	}
+	for _, crl := range crls {
+		archival.CRLs = append(archival.CRLs, asn1.RawValue{FullBytes: crl})
+	}
+
+	der, err := asn1.Marshal(archival)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: der}, nil
+}
+
+// Validate validates PdfSignature, including the embedded revocation information.
+func (a *adobePAdESLTV) Validate(sig *model.PdfSignature, digest model.Hasher) (model.SignatureValidationResult, error) {
+	signed := sig.Contents.Bytes()
+	p7, err := pkcs7.Parse(signed)
+	if err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	buffer := digest.(*bytes.Buffer)
+	p7.Content = buffer.Bytes()
+	if err = p7.Verify(); err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	if len(p7.Signers) == 0 {
+		return model.SignatureValidationResult{}, errors.New("sighandler: no signers found")
+	}
+	if err := validateRevocationInfoArchival(p7); err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	return model.SignatureValidationResult{
+		IsSigned:   true,
+		IsVerified: true,
+	}, nil
+}
+
+// validateRevocationInfoArchival checks that the first signer of p7 carries a
+// well-formed RevocationInfoArchival unsigned attribute, required for LTV validation.
+func validateRevocationInfoArchival(p7 *pkcs7.PKCS7) error {
+	for _, attr := range p7.Signers[0].UnauthenticatedAttributes {
+		if !attr.Type.Equal(oidRevocationInfoArchival) {
+			continue
+		}
+
+		var archival revocationInfoArchival
+		if _, err := asn1.Unmarshal(attr.Value.Bytes, &archival); err != nil {
+			return fmt.Errorf("sighandler: invalid RevocationInfoArchival attribute: %w", err)
+		}
+		if len(archival.OCSPs) == 0 && len(archival.CRLs) == 0 {
+			return errors.New("sighandler: RevocationInfoArchival attribute carries no revocation data")
+		}
+		return nil
+	}
+	return errors.New("sighandler: missing RevocationInfoArchival attribute, signature is not LTV enabled")
+}
+
+// ValidateDSS additionally checks that dss — the document catalog's /DSS dictionary,
+// parsed by the caller — carries an OCSP response or CRL covering the certificate that
+// produced sig, and that it reports that certificate as good. adobePAdESLTV.Validate on
+// its own only re-derives LTV status from the signature's own embedded
+// RevocationInfoArchival attribute (see validateRevocationInfoArchival); call ValidateDSS
+// as well to additionally cross-check against the document-wide /DSS store, for example
+// for a B-LTA signature that protects several earlier signatures at once. dss's /OCSPs and
+// /CRLs arrays are expected to hold the raw DER streams BuildDSS produces.
+func ValidateDSS(sig *model.PdfSignature, dss *core.PdfObjectDictionary) error {
+	if sig == nil || sig.Contents == nil {
+		return errors.New("sighandler: signature must not be nil")
+	}
+	if dss == nil {
+		return errors.New("sighandler: dss must not be nil")
+	}
+
+	p7, err := pkcs7.Parse(sig.Contents.Bytes())
+	if err != nil {
+		return err
+	}
+	if len(p7.Signers) == 0 {
+		return errors.New("sighandler: no signers found")
+	}
+	serial := p7.Signers[0].IssuerAndSerialNumber.SerialNumber
+	var signerIssuer pkix.RDNSequence
+	if _, err := asn1.Unmarshal(p7.Signers[0].IssuerAndSerialNumber.IssuerName.FullBytes, &signerIssuer); err != nil {
+		return fmt.Errorf("sighandler: parsing signer issuer name: %w", err)
+	}
+
+	ocspResponses, err := dssStreams(dss, "OCSPs")
+	if err != nil {
+		return err
+	}
+	for _, der := range ocspResponses {
+		resp, err := ocsp.ParseResponse(der, nil)
+		if err != nil || resp.SerialNumber == nil || resp.SerialNumber.Cmp(serial) != 0 {
+			continue
+		}
+		if resp.Status != ocsp.Good {
+			return fmt.Errorf("sighandler: /DSS OCSP response reports signer certificate status %d, want good (0)", resp.Status)
+		}
+		return nil
+	}
+
+	crls, err := dssStreams(dss, "CRLs")
+	if err != nil {
+		return err
+	}
+	for _, der := range crls {
+		crl, err := x509.ParseCRL(der)
+		if err != nil || crl.TBSCertList.Issuer.String() != signerIssuer.String() {
+			continue
+		}
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(serial) == 0 {
+				return fmt.Errorf("sighandler: /DSS CRL reports signer certificate %v as revoked", serial)
+			}
+		}
+		return nil
+	}
+
+	return errors.New("sighandler: /DSS carries no OCSP response or CRL covering the signer certificate")
+}
+
+// dssStreams decodes every stream object in dss's array entry named key (one of /Certs,
+// /OCSPs or /CRLs, see BuildDSS) and returns their raw bytes.
+func dssStreams(dss *core.PdfObjectDictionary, key core.PdfObjectName) ([][]byte, error) {
+	arr, found := core.GetArray(dss.Get(key))
+	if !found {
+		return nil, nil
+	}
+
+	var streams [][]byte
+	for i := 0; i < arr.Len(); i++ {
+		stream, found := core.GetStream(arr.Get(i))
+		if !found {
+			return nil, fmt.Errorf("sighandler: /DSS /%s entry %d is not a stream", key, i)
+		}
+		decoded, err := core.DecodeStream(stream)
+		if err != nil {
+			return nil, fmt.Errorf("sighandler: decoding /DSS /%s entry %d: %w", key, i, err)
+		}
+		streams = append(streams, decoded)
+	}
+	return streams, nil
+}
+
+// Sign sets the Contents field, embedding the revocation information required for LTV.
+func (a *adobePAdESLTV) Sign(sig *model.PdfSignature, digest model.Hasher) error {
+	if a.emptySignature {
+		sigLen := a.emptySignatureLen
+		if sigLen <= 0 {
+			sigLen = 8192
+		}
+
+		sig.Contents = core.MakeHexString(string(make([]byte, sigLen)))
+		return nil
+	}
+
+	revocationInfo, err := a.buildRevocationInfoArchival()
+	if err != nil {
+		return err
+	}
+
+	buffer := digest.(*bytes.Buffer)
+	signedData, err := pkcs7.NewSignedData(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+
+	config := pkcs7.SignerInfoConfig{
+		ExtraUnsignedAttributes: []pkcs7.Attribute{
+			{Type: oidRevocationInfoArchival, Value: revocationInfo},
+		},
+	}
+	if err := signedData.AddSignerChain(a.certificate, a.signer, a.chain, config); err != nil {
+		return err
+	}
+
+	signedData.Detach()
+	detachedSignature, err := signedData.Finish()
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 8192*2+2)
+	if len(detachedSignature) > len(data) {
+		return fmt.Errorf("sighandler: signature with embedded revocation information is %d bytes, exceeds the %d byte Contents reservation", len(detachedSignature), len(data))
+	}
+	copy(data, detachedSignature)
+
+	sig.Contents = core.MakeHexString(string(data))
+	return nil
+}
+
+// IsApplicable returns true if the signature handler is applicable for the PdfSignature.
+// Besides the Filter/SubFilter pair it shares with the other CAdES.detached handlers in
+// this package, a PAdES B-LT/B-LTA signature is only recognised as such by the presence of
+// its RevocationInfoArchival unsigned attribute; without this check a plain approval
+// signature handler registered ahead of this one would validate it while silently skipping
+// the LTV revocation check.
+func (a *adobePAdESLTV) IsApplicable(sig *model.PdfSignature) bool {
+	if sig == nil || sig.Filter == nil || sig.SubFilter == nil {
+		return false
+	}
+	if !((*sig.Filter == "Adobe.PPKMS" || *sig.Filter == "Adobe.PPKLite") && *sig.SubFilter == "ETSI.CAdES.detached") {
+		return false
+	}
+	return hasUnauthenticatedAttribute(sig, oidRevocationInfoArchival)
+}
@@ -0,0 +1,133 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/xwc1125/gopdf/core"
+	"github.com/xwc1125/gopdf/model"
+	"github.com/xwc1125/gopdf/model/signer"
+)
+
+// stubRevocationFetcher is a RevocationFetcher that returns a fixed, arbitrary DER value
+// for every certificate instead of actually contacting an OCSP responder or CRL
+// distribution point, so tests can drive adobePAdESLTV's Sign/Validate path without
+// network access.
+type stubRevocationFetcher struct {
+	ocsp []byte
+	crl  []byte
+}
+
+func (f *stubRevocationFetcher) FetchOCSP(leaf, issuer *x509.Certificate) ([]byte, error) {
+	return f.ocsp, nil
+}
+
+func (f *stubRevocationFetcher) FetchCRL(leaf *x509.Certificate) ([]byte, error) {
+	return f.crl, nil
+}
+
+func TestAdobePAdESLTVSignAndValidate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	leaf, chain, _ := leafCertWithIssuer(t, &key.PublicKey, key)
+
+	ocspResp, err := asn1.Marshal("stand-in OCSP response")
+	if err != nil {
+		t.Fatalf("marshalling stand-in OCSP response: %v", err)
+	}
+	fetcher := &stubRevocationFetcher{ocsp: ocspResp}
+
+	handler, err := NewPAdESLTV(signer.NewKMSSigner(key, leaf, chain), fetcher)
+	if err != nil {
+		t.Fatalf("NewPAdESLTV: %v", err)
+	}
+	signAndValidate(t, handler)
+}
+
+func TestAdobePAdESLTVSignRequiresRevocationInfo(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	leaf, chain, _ := leafCertWithIssuer(t, &key.PublicKey, key)
+
+	handler, err := NewPAdESLTV(signer.NewKMSSigner(key, leaf, chain), &stubRevocationFetcher{})
+	if err != nil {
+		t.Fatalf("NewPAdESLTV: %v", err)
+	}
+
+	sig := &model.PdfSignature{}
+	if err := handler.InitSignature(sig); err == nil {
+		t.Error("InitSignature did not reject a chain with no revocation information available")
+	}
+}
+
+func TestValidateDSS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	leaf, chain, caKey := leafCertWithIssuer(t, &key.PublicKey, key)
+	issuer := chain[0]
+
+	handler, err := NewAdobeRSAPSSDetached(signer.NewKMSSigner(key, leaf, chain), 0, 0)
+	if err != nil {
+		t.Fatalf("NewAdobeRSAPSSDetached: %v", err)
+	}
+	sig := signAndValidate(t, handler)
+
+	// The issuer certificate returned by leafCertWithIssuer is self-signed, so its own key
+	// doubles as the OCSP responder's signing key here.
+	ocspResp, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, caKey)
+	if err != nil {
+		t.Fatalf("creating OCSP response: %v", err)
+	}
+
+	ocspStream, err := core.MakeStream(ocspResp, core.NewRawEncoder())
+	if err != nil {
+		t.Fatalf("MakeStream: %v", err)
+	}
+	dss := core.MakeDict()
+	dss.Set("OCSPs", core.MakeArray(ocspStream))
+
+	if err := ValidateDSS(sig, dss); err != nil {
+		t.Errorf("ValidateDSS rejected a /DSS carrying a good OCSP response for the signer: %v", err)
+	}
+}
+
+func TestValidateDSSNoMatchingEntry(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	leaf, chain, _ := leafCertWithIssuer(t, &key.PublicKey, key)
+
+	handler, err := NewAdobeRSAPSSDetached(signer.NewKMSSigner(key, leaf, chain), 0, 0)
+	if err != nil {
+		t.Fatalf("NewAdobeRSAPSSDetached: %v", err)
+	}
+	sig := signAndValidate(t, handler)
+
+	dss := core.MakeDict()
+	if err := ValidateDSS(sig, dss); err == nil {
+		t.Error("ValidateDSS did not reject an empty /DSS")
+	}
+}
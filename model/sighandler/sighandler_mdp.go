@@ -0,0 +1,239 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/xwc1125/gopdf/core"
+	"github.com/xwc1125/gopdf/model"
+)
+
+// DocMDPPermission specifies the access permissions granted to the rest of a certified
+// PDF document by its DocMDP transform (ISO 32000-2, 12.8.2.2, Table 254).
+type DocMDPPermission int
+
+const (
+	// DocMDPNoChanges disallows any further changes to the document.
+	DocMDPNoChanges DocMDPPermission = 1
+	// DocMDPFormFillAndSign allows filling in form fields and adding approval signatures,
+	// in addition to what DocMDPNoChanges allows.
+	DocMDPFormFillAndSign DocMDPPermission = 2
+	// DocMDPAnnotations allows commenting, filling in form fields and adding approval
+	// signatures, in addition to what DocMDPFormFillAndSign allows.
+	DocMDPAnnotations DocMDPPermission = 3
+)
+
+// CertifySignature turns sig into a certification (MDP) signature permitting perms. It
+// attaches a /Reference array containing a SigRef dictionary whose TransformMethod is
+// /DocMDP (ISO 32000-2, 12.8.2.2). Only one certification signature is permitted per
+// document, and it must be the first signature applied.
+//
+// sig must already have gone through its SignatureHandler's InitSignature (and, in turn,
+// Sign); every handler in this package has InitSignature unconditionally reset
+// sig.Reference to nil, so calling CertifySignature first would have its /Reference array
+// silently discarded the moment the handler runs. CertifySignature rejects a sig with no
+// Handler attached; it cannot tell whether InitSignature has already run on a sig whose
+// Handler was set without it.
+//
+// CertifySignature only populates sig itself; call BuildPerms once sig has been added to
+// the document (so it has a containing indirect object) to obtain the /Perms dictionary
+// the caller must then attach to the document catalog, since the catalog is outside the
+// scope of a SignatureHandler.
+func CertifySignature(sig *model.PdfSignature, perms DocMDPPermission) error {
+	if sig == nil {
+		return errors.New("sighandler: signature must not be nil")
+	}
+	if sig.Handler == nil {
+		return errors.New("sighandler: signature has not been initialised yet; call CertifySignature after the SignatureHandler's InitSignature, not before")
+	}
+	switch perms {
+	case DocMDPNoChanges, DocMDPFormFillAndSign, DocMDPAnnotations:
+	default:
+		return fmt.Errorf("sighandler: invalid DocMDP permission level %d", perms)
+	}
+
+	transformParams := core.MakeDict()
+	transformParams.Set("Type", core.MakeName("TransformParams"))
+	transformParams.Set("P", core.MakeInteger(int64(perms)))
+	transformParams.Set("V", core.MakeName("1.2"))
+
+	sigRef := core.MakeDict()
+	sigRef.Set("Type", core.MakeName("SigRef"))
+	sigRef.Set("TransformMethod", core.MakeName("DocMDP"))
+	sigRef.Set("TransformParams", transformParams)
+
+	sig.Reference = core.MakeArray(sigRef)
+	return nil
+}
+
+// BuildPerms builds the document catalog's /Perms dictionary (ISO 32000-2, 12.8.2.1) for a
+// document certified with sig, whose /DocMDP entry must be an indirect reference to the
+// certifying signature's own container. Call it only after sig has a containing indirect
+// object, i.e. after it has been added to the document the usual way a SignatureHandler's
+// caller adds signature fields; the caller is then responsible for attaching the returned
+// dictionary to the document catalog's /Perms entry before the document is written.
+func BuildPerms(sig *model.PdfSignature) (*core.PdfObjectDictionary, error) {
+	if sig == nil {
+		return nil, errors.New("sighandler: signature must not be nil")
+	}
+	container := sig.GetContainingPdfObject()
+	if container == nil {
+		return nil, errors.New("sighandler: signature has no containing PDF object; add it to the document before calling BuildPerms")
+	}
+
+	perms := core.MakeDict()
+	perms.Set("DocMDP", container)
+	return perms, nil
+}
+
+// FieldMDPAction specifies which of a FieldMDP transform's named fields are locked
+// (ISO 32000-2, 12.8.2.3, Table 256).
+type FieldMDPAction int
+
+const (
+	// FieldMDPInclude locks exactly the fields named in AddFieldMDP's fields argument.
+	FieldMDPInclude FieldMDPAction = iota
+	// FieldMDPExclude locks every field in the document except the ones named.
+	FieldMDPExclude
+	// FieldMDPAll locks every field in the document; no field names are required.
+	FieldMDPAll
+)
+
+// name returns the /Action value for a, as used in a FieldMDP TransformParams dictionary.
+func (a FieldMDPAction) name() (string, error) {
+	switch a {
+	case FieldMDPInclude:
+		return "Include", nil
+	case FieldMDPExclude:
+		return "Exclude", nil
+	case FieldMDPAll:
+		return "All", nil
+	default:
+		return "", fmt.Errorf("sighandler: invalid FieldMDP action %d", a)
+	}
+}
+
+// AddFieldMDP appends a FieldMDP transform to sig's /Reference array, locking the form
+// fields named by fields (or, for FieldMDPAll, every field in the document) against
+// further changes. Unlike CertifySignature, AddFieldMDP may be used on both certification
+// and ordinary approval signatures, and a signature's /Reference array may carry more than
+// one FieldMDP transform.
+func AddFieldMDP(sig *model.PdfSignature, action FieldMDPAction, fields []string) error {
+	if sig == nil {
+		return errors.New("sighandler: signature must not be nil")
+	}
+	actionName, err := action.name()
+	if err != nil {
+		return err
+	}
+	if action == FieldMDPAll && len(fields) > 0 {
+		return errors.New("sighandler: FieldMDPAll does not take a list of fields")
+	}
+	if action != FieldMDPAll && len(fields) == 0 {
+		return errors.New("sighandler: FieldMDPInclude/FieldMDPExclude require at least one field")
+	}
+
+	transformParams := core.MakeDict()
+	transformParams.Set("Type", core.MakeName("TransformParams"))
+	transformParams.Set("Action", core.MakeName(actionName))
+	if len(fields) > 0 {
+		names := core.MakeArray()
+		for _, field := range fields {
+			names.Append(core.MakeString(field))
+		}
+		transformParams.Set("Fields", names)
+	}
+	transformParams.Set("V", core.MakeName("1.2"))
+
+	sigRef := core.MakeDict()
+	sigRef.Set("Type", core.MakeName("SigRef"))
+	sigRef.Set("TransformMethod", core.MakeName("FieldMDP"))
+	sigRef.Set("TransformParams", transformParams)
+
+	if sig.Reference == nil {
+		sig.Reference = core.MakeArray()
+	}
+	sig.Reference.Append(sigRef)
+	return nil
+}
+
+// ExtractByteRange returns the bytes of raw covered by sig's /ByteRange entry (ISO
+// 32000-2, 12.8.1): the two spans of raw that were hashed when sig was produced,
+// concatenated together with the /Contents placeholder itself excluded. Because
+// incremental updates only ever append bytes, these offsets stay valid in every later
+// revision of the document. Applied to the certified revision, ExtractByteRange gives
+// ValidateDocMDP's certifiedRevision argument. Applied to a later revision it still
+// returns only those two spans: the bytes that revision appends after the end of the
+// second span are not included, and must be added to its result to form ValidateDocMDP's
+// current argument.
+func ExtractByteRange(sig *model.PdfSignature, raw []byte) ([]byte, error) {
+	if sig == nil || sig.ByteRange == nil {
+		return nil, errors.New("sighandler: signature has no /ByteRange entry")
+	}
+	if sig.ByteRange.Len() != 4 {
+		return nil, fmt.Errorf("sighandler: /ByteRange has %d entries, want 4", sig.ByteRange.Len())
+	}
+
+	offsets := make([]int64, 4)
+	for i := 0; i < 4; i++ {
+		n, ok := core.GetIntVal(sig.ByteRange.Get(i))
+		if !ok {
+			return nil, fmt.Errorf("sighandler: /ByteRange entry %d is not an integer", i)
+		}
+		offsets[i] = int64(n)
+	}
+
+	var out bytes.Buffer
+	for i := 0; i < 2; i++ {
+		start, length := offsets[2*i], offsets[2*i+1]
+		end := start + length
+		if start < 0 || length < 0 || end > int64(len(raw)) {
+			return nil, fmt.Errorf("sighandler: /ByteRange span [%d, %d) is out of bounds for a %d byte document", start, end, len(raw))
+		}
+		out.Write(raw[start:end])
+	}
+	return out.Bytes(), nil
+}
+
+// ValidateDocMDP checks that certifiedRevision — the exact bytes covered by a
+// certification signature's /ByteRange at the time it was applied — is still a
+// byte-for-byte prefix of current, the same /ByteRange-covered bytes taken from the
+// document being validated followed by every byte that document appends after the end of
+// the /ByteRange's second span, and that any incremental update current carries beyond
+// certifiedRevision is one perms actually permits. None of the bytes making up the
+// certified revision may be altered by a later incremental update under any permission
+// level; that part of the check is byte-for-byte and exact. For perms == DocMDPNoChanges
+// the ISO 32000-2 Table 254 rule is equally exact: no incremental update is permitted at
+// all, so current must be byte-identical to certifiedRevision. DocMDPFormFillAndSign and
+// DocMDPAnnotations instead permit specific kinds of incremental update (form fills and
+// approval signatures, or additionally annotations) while forbidding others (e.g. page
+// content edits); telling those apart requires parsing the appended update's object graph,
+// which ValidateDocMDP does not do, so at those two permission levels it only enforces the
+// certified-bytes-unchanged invariant and does not flag an otherwise-disallowed append.
+//
+// Use ExtractByteRange to obtain certifiedRevision and the leading part of current (see
+// ExtractByteRange for the appended bytes current must also carry), and invoke
+// ValidateDocMDP alongside the certifying signature's own SignatureHandler.Validate.
+func ValidateDocMDP(perms DocMDPPermission, certifiedRevision, current []byte) error {
+	switch perms {
+	case DocMDPNoChanges, DocMDPFormFillAndSign, DocMDPAnnotations:
+	default:
+		return fmt.Errorf("sighandler: invalid DocMDP permission level %d", perms)
+	}
+	if len(current) < len(certifiedRevision) {
+		return fmt.Errorf("sighandler: current document (%d bytes) is shorter than the certified revision (%d bytes)", len(current), len(certifiedRevision))
+	}
+	if !bytes.Equal(certifiedRevision, current[:len(certifiedRevision)]) {
+		return errors.New("sighandler: DocMDP violation: the certified revision was modified by a later incremental update")
+	}
+	if perms == DocMDPNoChanges && len(current) != len(certifiedRevision) {
+		return fmt.Errorf("sighandler: DocMDP violation: DocMDPNoChanges permits no incremental update at all, but the document grew by %d bytes after certification", len(current)-len(certifiedRevision))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/xwc1125/gopdf/core"
+	"github.com/xwc1125/gopdf/model"
+)
+
+func TestBuildPerms(t *testing.T) {
+	handler, err := NewEmptyAdobeRSAPSSDetached(0)
+	if err != nil {
+		t.Fatalf("NewEmptyAdobeRSAPSSDetached: %v", err)
+	}
+	sig := model.NewPdfSignature(handler)
+
+	if err := CertifySignature(sig, DocMDPFormFillAndSign); err != nil {
+		t.Fatalf("CertifySignature: %v", err)
+	}
+
+	perms, err := BuildPerms(sig)
+	if err != nil {
+		t.Fatalf("BuildPerms: %v", err)
+	}
+	docMDP, found := perms.Get("DocMDP").(*core.PdfIndirectObject)
+	if !found {
+		t.Fatalf("/Perms /DocMDP is %T, want *core.PdfIndirectObject", perms.Get("DocMDP"))
+	}
+	if docMDP != sig.GetContainingPdfObject() {
+		t.Error("/Perms /DocMDP does not reference sig's own containing object")
+	}
+}
+
+func TestCertifySignatureRequiresInitialisedHandler(t *testing.T) {
+	sig := model.NewPdfSignature(nil)
+	if err := CertifySignature(sig, DocMDPFormFillAndSign); err == nil {
+		t.Error("CertifySignature did not reject a signature with no handler attached yet")
+	}
+}
+
+func TestBuildPermsRequiresSignature(t *testing.T) {
+	if _, err := BuildPerms(nil); err == nil {
+		t.Fatal("BuildPerms did not reject a nil signature")
+	}
+}
+
+func TestExtractByteRangeAndValidateDocMDP(t *testing.T) {
+	sig := model.NewPdfSignature(nil)
+	sig.ByteRange = core.MakeArray(
+		core.MakeInteger(0), core.MakeInteger(4),
+		core.MakeInteger(8), core.MakeInteger(4),
+	)
+
+	original := []byte("AAAA....BBBB")
+	certifiedRevision, err := ExtractByteRange(sig, original)
+	if err != nil {
+		t.Fatalf("ExtractByteRange(original): %v", err)
+	}
+	if !bytes.Equal(certifiedRevision, []byte("AAAABBBB")) {
+		t.Fatalf("certifiedRevision = %q, want %q", certifiedRevision, "AAAABBBB")
+	}
+
+	appended := append(append([]byte{}, original...), []byte("...appended update...")...)
+	current, err := ExtractByteRange(sig, appended)
+	if err != nil {
+		t.Fatalf("ExtractByteRange(appended): %v", err)
+	}
+	current = append(current, appended[len(original):]...)
+	if err := ValidateDocMDP(DocMDPFormFillAndSign, certifiedRevision, current); err != nil {
+		t.Errorf("ValidateDocMDP rejected a DocMDPFormFillAndSign document for an unrelated append: %v", err)
+	}
+
+	tampered := append([]byte{}, appended...)
+	tampered[1] = 'X'
+	tamperedRange, err := ExtractByteRange(sig, tampered)
+	if err != nil {
+		t.Fatalf("ExtractByteRange(tampered): %v", err)
+	}
+	if err := ValidateDocMDP(DocMDPFormFillAndSign, certifiedRevision, tamperedRange); err == nil {
+		t.Error("ValidateDocMDP did not detect a modified certified revision")
+	}
+}
+
+func TestValidateDocMDPNoChangesRejectsAnyAppend(t *testing.T) {
+	sig := model.NewPdfSignature(nil)
+	sig.ByteRange = core.MakeArray(
+		core.MakeInteger(0), core.MakeInteger(4),
+		core.MakeInteger(8), core.MakeInteger(4),
+	)
+
+	original := []byte("AAAA....BBBB")
+	certifiedRevision, err := ExtractByteRange(sig, original)
+	if err != nil {
+		t.Fatalf("ExtractByteRange(original): %v", err)
+	}
+
+	if err := ValidateDocMDP(DocMDPNoChanges, certifiedRevision, certifiedRevision); err != nil {
+		t.Errorf("ValidateDocMDP rejected a DocMDPNoChanges document with no incremental update: %v", err)
+	}
+
+	appended := append(append([]byte{}, original...), []byte("...appended update...")...)
+	current, err := ExtractByteRange(sig, appended)
+	if err != nil {
+		t.Fatalf("ExtractByteRange(appended): %v", err)
+	}
+	current = append(current, appended[len(original):]...)
+	if err := ValidateDocMDP(DocMDPNoChanges, certifiedRevision, current); err == nil {
+		t.Error("ValidateDocMDP did not reject an incremental update on a DocMDPNoChanges document")
+	}
+}
+
+func TestExtractByteRangeOutOfBounds(t *testing.T) {
+	sig := model.NewPdfSignature(nil)
+	sig.ByteRange = core.MakeArray(
+		core.MakeInteger(0), core.MakeInteger(4),
+		core.MakeInteger(100), core.MakeInteger(4),
+	)
+	if _, err := ExtractByteRange(sig, []byte("AAAA....")); err == nil {
+		t.Error("ExtractByteRange did not reject an out-of-bounds /ByteRange span")
+	}
+}
@@ -0,0 +1,372 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/digitorus/pkcs7"
+
+	"github.com/xwc1125/gopdf/core"
+	"github.com/xwc1125/gopdf/model"
+)
+
+// oidEncryptionAlgorithmRSASSAPSS is id-RSASSA-PSS (RFC 8017, A.2.3), the
+// AlgorithmIdentifier OID for a SignerInfo signed with RSASSA-PSS rather than PKCS#1 v1.5.
+var oidEncryptionAlgorithmRSASSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+
+// oidMGF1 is id-mgf1 (RFC 8017, A.2.1), the mask generation function used by RSASSA-PSS.
+var oidMGF1 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+
+// rsaSSAPSSParams mirrors the RSASSA-PSS-params ASN.1 structure (RFC 8017, A.2.3). Fields
+// are explicitly tagged and always written out, rather than relying on their DEFAULTs,
+// so that verifiers that do not implement the SHA-1/MGF1-SHA-1 defaults still succeed.
+type rsaSSAPSSParams struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength   int                      `asn1:"explicit,tag:2"`
+	TrailerField int                      `asn1:"explicit,tag:3"`
+}
+
+// signedAttribute mirrors pkcs7's internal attribute representation, letting us recompute
+// the DER encoding of a SignerInfo's already-finalised AuthenticatedAttributes (the data
+// that is actually signed) without needing access to pkcs7's unexported types.
+type signedAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+// marshalSignedAttributes re-derives the bytes that are signed for a SET OF Attribute, by
+// marshalling it as a SET and then dropping the outer tag/length, exactly as pkcs7 does
+// internally when producing and verifying a SignerInfo's signature.
+func marshalSignedAttributes(attrs []signedAttribute) ([]byte, error) {
+	encoded, err := asn1.Marshal(struct {
+		A []signedAttribute `asn1:"set"`
+	}{A: attrs})
+	if err != nil {
+		return nil, err
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(encoded, &raw); err != nil {
+		return nil, err
+	}
+	return raw.Bytes, nil
+}
+
+// adobeRSAPSSDetached is an Adobe.PPKLite adbe.CAdES.detached signature handler that signs
+// with RSASSA-PSS (RFC 8017) instead of RSASSA-PKCS1-v1_5, as required by some eIDAS
+// qualified trust services.
+type adobeRSAPSSDetached struct {
+	signer      model.Signer
+	certificate *x509.Certificate
+	hash        crypto.Hash
+	saltLength  int
+
+	emptySignature    bool
+	emptySignatureLen int
+}
+
+// NewEmptyAdobeRSAPSSDetached creates a new Adobe.PPKLite adbe.CAdES.detached RSASSA-PSS
+// signature handler producing an empty signature of size signatureLen, for use when only
+// the Contents field size needs to be reserved.
+func NewEmptyAdobeRSAPSSDetached(signatureLen int) (model.SignatureHandler, error) {
+	return &adobeRSAPSSDetached{
+		emptySignature:    true,
+		emptySignatureLen: signatureLen,
+	}, nil
+}
+
+// NewAdobeRSAPSSDetached creates a new Adobe.PPKLite adbe.CAdES.detached signature handler
+// backed by signer, whose key must be an RSA key, signing with RSASSA-PSS using hash as
+// both the digest and the MGF1 hash. If hash is 0, crypto.SHA256 is used. If saltLength is
+// <= 0, it defaults to hash's output size, the value commonly required by eIDAS qualified
+// trust services.
+func NewAdobeRSAPSSDetached(signer model.Signer, hash crypto.Hash, saltLength int) (model.SignatureHandler, error) {
+	if signer != nil {
+		if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("sighandler: signer must hold an RSA key, got %T", signer.Public())
+		}
+	}
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	if saltLength <= 0 {
+		saltLength = hash.Size()
+	}
+	handler := &adobeRSAPSSDetached{signer: signer, hash: hash, saltLength: saltLength}
+	if signer != nil {
+		handler.certificate = signer.Certificate()
+	}
+	return handler, nil
+}
+
+// InitSignature initialises the PdfSignature.
+func (a *adobeRSAPSSDetached) InitSignature(sig *model.PdfSignature) error {
+	if !a.emptySignature {
+		if a.certificate == nil {
+			return errors.New("certificate must not be nil")
+		}
+		if a.signer == nil {
+			return errors.New("signer must not be nil")
+		}
+	}
+
+	handler := *a
+	sig.Handler = &handler
+	sig.Filter = core.MakeName("Adobe.PPKLite")
+	sig.SubFilter = core.MakeName("ETSI.CAdES.detached")
+	sig.Reference = nil
+
+	digest, err := handler.NewDigest(sig)
+	if err != nil {
+		return err
+	}
+	digest.Write([]byte("calculate the Contents field size"))
+	return handler.Sign(sig, digest)
+}
+
+// NewDigest creates a new digest.
+func (a *adobeRSAPSSDetached) NewDigest(sig *model.PdfSignature) (model.Hasher, error) {
+	return bytes.NewBuffer(nil), nil
+}
+
+// Validate validates PdfSignature, verifying the RSASSA-PSS signature directly since
+// pkcs7.Verify does not recognize the id-RSASSA-PSS AlgorithmIdentifier.
+func (a *adobeRSAPSSDetached) Validate(sig *model.PdfSignature, digest model.Hasher) (model.SignatureValidationResult, error) {
+	signed := sig.Contents.Bytes()
+	p7, err := pkcs7.Parse(signed)
+	if err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+	if len(p7.Signers) == 0 {
+		return model.SignatureValidationResult{}, errors.New("sighandler: no signers found")
+	}
+	signer := p7.Signers[0]
+
+	buffer := digest.(*bytes.Buffer)
+	messageHash, err := hashForOID(signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+	h := messageHash.New()
+	h.Write(buffer.Bytes())
+
+	var attrs []signedAttribute
+	for _, attr := range signer.AuthenticatedAttributes {
+		attrs = append(attrs, signedAttribute{Type: attr.Type, Value: attr.Value})
+	}
+	if err := verifyMessageDigestAttribute(attrs, h.Sum(nil)); err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	if !signer.DigestEncryptionAlgorithm.Algorithm.Equal(oidEncryptionAlgorithmRSASSAPSS) {
+		return model.SignatureValidationResult{}, fmt.Errorf("sighandler: expected id-RSASSA-PSS signature, got %v", signer.DigestEncryptionAlgorithm.Algorithm)
+	}
+	var params rsaSSAPSSParams
+	if _, err := asn1.Unmarshal(signer.DigestEncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return model.SignatureValidationResult{}, fmt.Errorf("sighandler: invalid RSASSA-PSS-params: %w", err)
+	}
+	pssHash, err := hashForOID(params.Hash.Algorithm)
+	if err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	tbs, err := marshalSignedAttributes(attrs)
+	if err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+	th := pssHash.New()
+	th.Write(tbs)
+
+	cert := p7.GetOnlySigner()
+	if cert == nil {
+		return model.SignatureValidationResult{}, errors.New("sighandler: could not determine signer certificate")
+	}
+	rsaKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return model.SignatureValidationResult{}, fmt.Errorf("sighandler: signer certificate does not hold an RSA key, got %T", cert.PublicKey)
+	}
+	opts := &rsa.PSSOptions{Hash: pssHash, SaltLength: params.SaltLength}
+	if err := rsa.VerifyPSS(rsaKey, pssHash, th.Sum(nil), signer.EncryptedDigest, opts); err != nil {
+		return model.SignatureValidationResult{}, fmt.Errorf("sighandler: RSASSA-PSS signature verification failed: %w", err)
+	}
+
+	return model.SignatureValidationResult{
+		IsSigned:   true,
+		IsVerified: true,
+	}, nil
+}
+
+// verifyMessageDigestAttribute checks that attrs carries a message-digest attribute
+// matching want.
+func verifyMessageDigestAttribute(attrs []signedAttribute, want []byte) error {
+	for _, attr := range attrs {
+		if !attr.Type.Equal(pkcs7.OIDAttributeMessageDigest) {
+			continue
+		}
+		var got []byte
+		if _, err := asn1.Unmarshal(attr.Value.Bytes, &got); err != nil {
+			return fmt.Errorf("sighandler: invalid message-digest attribute: %w", err)
+		}
+		if !bytes.Equal(got, want) {
+			return errors.New("sighandler: message-digest attribute does not match the signed content")
+		}
+		return nil
+	}
+	return errors.New("sighandler: missing message-digest attribute")
+}
+
+// decoySignerMu guards decoySigner.
+var decoySignerMu sync.Mutex
+
+// decoySigner is a process-wide placeholder RSA key, generated on first use.
+var decoySigner *rsa.PrivateKey
+
+// decoyRSASigner returns a placeholder RSA key with no security relevance of its own: it
+// exists only to drive pkcs7.SignedData.AddSignerChain's internal PKCS#1v1.5 signing step
+// for a SignerInfo whose signature adobeRSAPSSDetached.Sign immediately discards and
+// replaces with a real RSASSA-PSS one. The key is generated once and cached, since
+// generating it is the only cost of using it in place of the real signer.
+func decoyRSASigner() (*rsa.PrivateKey, error) {
+	decoySignerMu.Lock()
+	defer decoySignerMu.Unlock()
+	if decoySigner != nil {
+		return decoySigner, nil
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	decoySigner = key
+	return decoySigner, nil
+}
+
+// Sign sets the Contents field, signing the CMS SignerInfo with RSASSA-PSS.
+func (a *adobeRSAPSSDetached) Sign(sig *model.PdfSignature, digest model.Hasher) error {
+	if a.emptySignature {
+		sigLen := a.emptySignatureLen
+		if sigLen <= 0 {
+			sigLen = 8192
+		}
+
+		sig.Contents = core.MakeHexString(string(make([]byte, sigLen)))
+		return nil
+	}
+
+	digestOID, ok := hashOIDs[a.hash]
+	if !ok {
+		return fmt.Errorf("sighandler: unsupported RSASSA-PSS hash %v", a.hash)
+	}
+
+	buffer := digest.(*bytes.Buffer)
+	signedData, err := pkcs7.NewSignedData(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	signedData.SetDigestAlgorithm(digestOID)
+	// AddSignerChain always produces its own PKCS#1v1.5 signature over the authenticated
+	// attributes as a side effect of adding the SignerInfo; below, we discard that
+	// signature and replace it with a real RSASSA-PSS one. Drive AddSignerChain with a
+	// throwaway local key instead of a.signer so that discarded signature doesn't cost a
+	// second private-key operation against what may be a real KMS/HSM-backed model.Signer.
+	decoy, err := decoyRSASigner()
+	if err != nil {
+		return fmt.Errorf("sighandler: generating placeholder RSA key: %w", err)
+	}
+	if err := signedData.AddSignerChain(a.certificate, decoy, a.signer.Chain(), pkcs7.SignerInfoConfig{}); err != nil {
+		return err
+	}
+
+	signerInfos := signedData.GetSignedData().SignerInfos
+	si := &signerInfos[len(signerInfos)-1]
+
+	var attrs []signedAttribute
+	for _, attr := range si.AuthenticatedAttributes {
+		attrs = append(attrs, signedAttribute{Type: attr.Type, Value: attr.Value})
+	}
+	tbs, err := marshalSignedAttributes(attrs)
+	if err != nil {
+		return err
+	}
+	h := a.hash.New()
+	h.Write(tbs)
+
+	pssSignature, err := a.signer.Sign(rand.Reader, h.Sum(nil), &rsa.PSSOptions{Hash: a.hash, SaltLength: a.saltLength})
+	if err != nil {
+		return fmt.Errorf("sighandler: RSASSA-PSS signing failed: %w", err)
+	}
+
+	params, err := asn1.Marshal(rsaSSAPSSParams{
+		Hash:         pkix.AlgorithmIdentifier{Algorithm: digestOID, Parameters: asn1.RawValue{FullBytes: asn1NullBytes}},
+		MGF:          pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: algorithmIdentifierDER(digestOID)},
+		SaltLength:   a.saltLength,
+		TrailerField: 1,
+	})
+	if err != nil {
+		return err
+	}
+
+	si.EncryptedDigest = pssSignature
+	si.DigestEncryptionAlgorithm = pkix.AlgorithmIdentifier{
+		Algorithm:  oidEncryptionAlgorithmRSASSAPSS,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}
+
+	signedData.Detach()
+	detachedSignature, err := signedData.Finish()
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 8192*2+2)
+	if len(detachedSignature) > len(data) {
+		return fmt.Errorf("sighandler: signature is %d bytes, exceeds the %d byte Contents reservation", len(detachedSignature), len(data))
+	}
+	copy(data, detachedSignature)
+
+	sig.Contents = core.MakeHexString(string(data))
+	return nil
+}
+
+// IsApplicable returns true if the signature handler is applicable for the PdfSignature.
+// Besides the Filter/SubFilter pair it shares with the other CAdES.detached handlers in
+// this package, this handler is only recognised by its id-RSASSA-PSS
+// DigestEncryptionAlgorithm, which no other handler in this package produces.
+func (a *adobeRSAPSSDetached) IsApplicable(sig *model.PdfSignature) bool {
+	if sig == nil || sig.Filter == nil || sig.SubFilter == nil {
+		return false
+	}
+	if !((*sig.Filter == "Adobe.PPKMS" || *sig.Filter == "Adobe.PPKLite") && *sig.SubFilter == "ETSI.CAdES.detached") {
+		return false
+	}
+	oid := signingAlgorithmOID(sig)
+	return oid != nil && oid.Equal(oidEncryptionAlgorithmRSASSAPSS)
+}
+
+// asn1NullBytes is the DER encoding of the ASN.1 NULL value, used as the (explicit, but
+// empty) parameters of a hash AlgorithmIdentifier.
+var asn1NullBytes = []byte{0x05, 0x00}
+
+// algorithmIdentifierDER returns the DER encoding of an AlgorithmIdentifier for oid with
+// NULL parameters, suitable for use as MGF1's own parameter.
+func algorithmIdentifierDER(oid asn1.ObjectIdentifier) asn1.RawValue {
+	der, err := asn1.Marshal(pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.RawValue{FullBytes: asn1NullBytes}})
+	if err != nil {
+		// Only possible if oid itself is malformed, which never happens for the
+		// well-known digest OIDs this is called with.
+		panic(err)
+	}
+	return asn1.RawValue{FullBytes: der}
+}
@@ -0,0 +1,213 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+
+	"github.com/xwc1125/gopdf/model"
+	"github.com/xwc1125/gopdf/model/signer"
+)
+
+// selfSignedCert creates a self-signed certificate for pub/priv, for use as a minimal
+// model.Signer in tests that only exercise the CMS produced by a SignatureHandler.
+func selfSignedCert(t *testing.T, pub interface{}, priv interface{}) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sighandler test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatalf("creating test certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing test certificate: %v", err)
+	}
+	return cert
+}
+
+// leafCertWithIssuer creates a certificate for pub, signed by a freshly generated
+// self-signed issuer CA, returning the leaf certificate, a one-certificate chain holding
+// that issuer, and the issuer's private key (for tests that also need to sign as the
+// issuer, e.g. to produce an OCSP response).
+func leafCertWithIssuer(t *testing.T, pub interface{}, priv interface{}) (*x509.Certificate, []*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "sighandler test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("creating CA certificate: %v", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("parsing CA certificate: %v", err)
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "sighandler test leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, pub, caKey)
+	if err != nil {
+		t.Fatalf("creating leaf certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatalf("parsing leaf certificate: %v", err)
+	}
+	return leaf, []*x509.Certificate{ca}, caKey
+}
+
+// signAndValidate drives handler through the same InitSignature -> NewDigest -> Sign ->
+// Validate sequence a real caller would, against a placeholder document digest, and
+// returns the resulting PdfSignature for further inspection.
+func signAndValidate(t *testing.T, handler model.SignatureHandler) *model.PdfSignature {
+	t.Helper()
+	sig := &model.PdfSignature{}
+	if err := handler.InitSignature(sig); err != nil {
+		t.Fatalf("InitSignature: %v", err)
+	}
+
+	digest, err := sig.Handler.NewDigest(sig)
+	if err != nil {
+		t.Fatalf("NewDigest: %v", err)
+	}
+	digest.Write([]byte("the document bytes covered by this signature"))
+
+	if err := sig.Handler.Sign(sig, digest); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	result, err := sig.Handler.Validate(sig, digest)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !result.IsSigned || !result.IsVerified {
+		t.Fatalf("Validate returned %+v, want IsSigned and IsVerified", result)
+	}
+	return sig
+}
+
+func TestAdobeRSAPSSDetachedSignAndValidate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	cert := selfSignedCert(t, &key.PublicKey, key)
+
+	handler, err := NewAdobeRSAPSSDetached(signer.NewKMSSigner(key, cert, nil), 0, 0)
+	if err != nil {
+		t.Fatalf("NewAdobeRSAPSSDetached: %v", err)
+	}
+
+	sig := signAndValidate(t, handler)
+
+	p7, err := pkcs7.Parse(sig.Contents.Bytes())
+	if err != nil {
+		t.Fatalf("parsing emitted CMS: %v", err)
+	}
+	if len(p7.Signers) != 1 {
+		t.Fatalf("got %d signers, want 1", len(p7.Signers))
+	}
+	if !p7.Signers[0].DigestEncryptionAlgorithm.Algorithm.Equal(oidEncryptionAlgorithmRSASSAPSS) {
+		t.Fatalf("DigestEncryptionAlgorithm = %v, want id-RSASSA-PSS (%v)", p7.Signers[0].DigestEncryptionAlgorithm.Algorithm, oidEncryptionAlgorithmRSASSAPSS)
+	}
+}
+
+func TestAdobeRSAPSSDetachedSignAndValidateWithChain(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	leaf, chain, _ := leafCertWithIssuer(t, &key.PublicKey, key)
+
+	handler, err := NewAdobeRSAPSSDetached(signer.NewKMSSigner(key, leaf, chain), 0, 0)
+	if err != nil {
+		t.Fatalf("NewAdobeRSAPSSDetached: %v", err)
+	}
+	sig := signAndValidate(t, handler)
+
+	p7, err := pkcs7.Parse(sig.Contents.Bytes())
+	if err != nil {
+		t.Fatalf("parsing emitted CMS: %v", err)
+	}
+	if len(p7.Certificates) < 2 {
+		t.Fatalf("emitted CMS carries %d certificates, want at least 2 (leaf + issuer)", len(p7.Certificates))
+	}
+	var foundIssuer bool
+	for _, cert := range p7.Certificates {
+		if cert.Equal(chain[0]) {
+			foundIssuer = true
+		}
+	}
+	if !foundIssuer {
+		t.Error("emitted CMS does not carry the signer's issuer certificate")
+	}
+}
+
+func TestAdobeRSAPSSDetachedIsApplicable(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	cert := selfSignedCert(t, &key.PublicKey, key)
+
+	rsaPSSHandler, err := NewAdobeRSAPSSDetached(signer.NewKMSSigner(key, cert, nil), 0, 0)
+	if err != nil {
+		t.Fatalf("NewAdobeRSAPSSDetached: %v", err)
+	}
+	sig := signAndValidate(t, rsaPSSHandler)
+
+	if !rsaPSSHandler.IsApplicable(sig) {
+		t.Error("adobeRSAPSSDetached.IsApplicable returned false for its own signature")
+	}
+
+	eccHandler, err := NewAdobeECCDetached(nil)
+	if err != nil {
+		t.Fatalf("NewAdobeECCDetached: %v", err)
+	}
+	if eccHandler.IsApplicable(sig) {
+		t.Error("adobeECCDetached.IsApplicable returned true for an RSASSA-PSS signature")
+	}
+
+	edKey, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating Ed25519 key: %v", err)
+	}
+	edCert := selfSignedCert(t, edKey, edPriv)
+	edHandler, err := NewAdobeEd25519Detached(signer.NewKMSSigner(edPriv, edCert, nil))
+	if err != nil {
+		t.Fatalf("NewAdobeEd25519Detached: %v", err)
+	}
+	if edHandler.IsApplicable(sig) {
+		t.Error("adobeEd25519Detached.IsApplicable returned true for an RSASSA-PSS signature")
+	}
+}
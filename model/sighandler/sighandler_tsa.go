@@ -0,0 +1,416 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+
+	"github.com/digitorus/pkcs7"
+
+	"github.com/xwc1125/gopdf/core"
+	"github.com/xwc1125/gopdf/model"
+)
+
+// oidSignatureTimeStampToken is the CAdES/ESS unsigned attribute OID (id-aa-signatureTimeStampToken)
+// used to embed an RFC 3161 TimeStampToken covering a CMS signature value.
+var oidSignatureTimeStampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+
+// hashOIDs maps a crypto.Hash to the digest algorithm OID expected by an RFC 3161 TSA.
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   pkcs7.OIDDigestAlgorithmSHA1,
+	crypto.SHA256: pkcs7.OIDDigestAlgorithmSHA256,
+	crypto.SHA384: pkcs7.OIDDigestAlgorithmSHA384,
+	crypto.SHA512: pkcs7.OIDDigestAlgorithmSHA512,
+}
+
+// messageImprint is the RFC 3161 MessageImprint structure: the hash of the data being
+// timestamped, together with the algorithm used to compute it.
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// timeStampReq is the RFC 3161 TimeStampReq structure sent to a TSA.
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+// pkiStatusInfo is the RFC 3161 PKIStatusInfo structure.
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+// timeStampResp is the RFC 3161 TimeStampResp structure returned by a TSA. TimeStampToken
+// is kept as a raw value so that it can be embedded byte-for-byte as a CMS attribute.
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// tstInfo is the RFC 3161 TSTInfo structure, the content of a TimeStampToken.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+	Accuracy       asn1.RawValue `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	Tsa            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// TSAClient requests RFC 3161 timestamp tokens from a Time-Stamping Authority over HTTP.
+type TSAClient struct {
+	// URL is the TSA endpoint to POST timestamp-query requests to.
+	URL string
+	// HTTPClient is used to perform the request. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// HashAlgorithm is the message-imprint hash requested from the TSA. Defaults to
+	// crypto.SHA256 if zero.
+	HashAlgorithm crypto.Hash
+	// IncludeNonce adds a random nonce to the request. Timestamp does not check that the
+	// returned token carries the same nonce.
+	IncludeNonce bool
+	// CertReq asks the TSA to include its signing certificate in the token.
+	CertReq bool
+	// Username and Password, if Username is non-empty, are sent as HTTP basic auth.
+	Username string
+	Password string
+}
+
+// NewTSAClient returns a TSAClient for the TSA at url, requesting a SHA-256 message
+// imprint with a nonce and the TSA's certificate included in the response.
+func NewTSAClient(url string) *TSAClient {
+	return &TSAClient{
+		URL:           url,
+		HashAlgorithm: crypto.SHA256,
+		IncludeNonce:  true,
+		CertReq:       true,
+	}
+}
+
+// Timestamp requests a timestamp token covering signatureValue, the signature value being
+// timestamped, and returns the DER encoded TimeStampToken (a ContentInfo of type
+// id-signedData) on success.
+func (c *TSAClient) Timestamp(signatureValue []byte) ([]byte, error) {
+	hashAlg := c.HashAlgorithm
+	if hashAlg == 0 {
+		hashAlg = crypto.SHA256
+	}
+	oid, ok := hashOIDs[hashAlg]
+	if !ok {
+		return nil, fmt.Errorf("sighandler: unsupported TSA hash algorithm %v", hashAlg)
+	}
+	if !hashAlg.Available() {
+		return nil, fmt.Errorf("sighandler: hash algorithm %v is not linked into the binary", hashAlg)
+	}
+
+	h := hashAlg.New()
+	h.Write(signatureValue)
+
+	req := timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid},
+			HashedMessage: h.Sum(nil),
+		},
+		CertReq: c.CertReq,
+	}
+	if c.IncludeNonce {
+		nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+		if err != nil {
+			return nil, fmt.Errorf("sighandler: generating TSA nonce: %w", err)
+		}
+		req.Nonce = nonce
+	}
+
+	reqDER, err := asn1.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("sighandler: marshalling TimeStampReq: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(reqDER))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/timestamp-query")
+	if c.Username != "" {
+		httpReq.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("sighandler: requesting timestamp: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sighandler: TSA %s returned status %d", c.URL, httpResp.StatusCode)
+	}
+
+	var resp timeStampResp
+	if _, err := asn1.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("sighandler: parsing TimeStampResp: %w", err)
+	}
+	if resp.Status.Status != 0 && resp.Status.Status != 1 {
+		return nil, fmt.Errorf("sighandler: TSA rejected timestamp request, status %d", resp.Status.Status)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("sighandler: TSA response carries no TimeStampToken")
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
+
+// Validate checks that token is a well-formed RFC 3161 TimeStampToken whose signature
+// chains to roots (if non-nil) and whose message imprint matches signatureValue, the CMS
+// signature value it is expected to cover.
+func (c *TSAClient) Validate(token []byte, signatureValue []byte, roots *x509.CertPool) error {
+	return validateTimestampToken(token, signatureValue, roots)
+}
+
+// validateTimestampToken checks that token is a well-formed RFC 3161 TimeStampToken whose
+// signature chains to roots (if non-nil) and whose message imprint matches imprinted, the
+// data it is expected to cover. imprinted is the CMS signature value for a timestamp
+// covering another signature (e.g. adobeCAdESDetachedTSA), or the signed document bytes
+// themselves for a standalone document timestamp (e.g. docTimeStamp).
+func validateTimestampToken(token []byte, imprinted []byte, roots *x509.CertPool) error {
+	p7, err := pkcs7.Parse(token)
+	if err != nil {
+		return fmt.Errorf("sighandler: parsing TimeStampToken: %w", err)
+	}
+	if err := p7.VerifyWithChain(roots); err != nil {
+		return fmt.Errorf("sighandler: verifying TimeStampToken: %w", err)
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(p7.Content, &info); err != nil {
+		return fmt.Errorf("sighandler: parsing TSTInfo: %w", err)
+	}
+
+	hashAlg, err := hashForOID(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	h := hashAlg.New()
+	h.Write(imprinted)
+	if !bytes.Equal(h.Sum(nil), info.MessageImprint.HashedMessage) {
+		return errors.New("sighandler: TimeStampToken message imprint does not match the expected data")
+	}
+	return nil
+}
+
+// hashForOID returns the crypto.Hash matching a digest algorithm OID.
+func hashForOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for hash, hashOID := range hashOIDs {
+		if hashOID.Equal(oid) {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("sighandler: unsupported digest algorithm OID %v", oid)
+}
+
+// adobeCAdESDetachedTSA is an Adobe.PPKLite adbe.CAdES.detached signature handler that
+// additionally embeds an RFC 3161 timestamp token over the signature value, so that the
+// signature remains verifiable once the signing certificate has expired (PAdES B-T).
+type adobeCAdESDetachedTSA struct {
+	signer      model.Signer
+	certificate *x509.Certificate
+	tsa         *TSAClient
+	tsaRoots    *x509.CertPool
+
+	emptySignature    bool
+	emptySignatureLen int
+}
+
+// NewEmptyAdobeCAdESDetachedWithTSA creates a new Adobe.PPKLite adbe.CAdES.detached
+// signature handler producing an empty signature of size signatureLen, for use when only
+// the Contents field size needs to be reserved.
+func NewEmptyAdobeCAdESDetachedWithTSA(signatureLen int) (model.SignatureHandler, error) {
+	return &adobeCAdESDetachedTSA{
+		emptySignature:    true,
+		emptySignatureLen: signatureLen,
+	}, nil
+}
+
+// NewAdobeCAdESDetachedWithTSA creates a new Adobe.PPKLite adbe.CAdES.detached signature
+// handler backed by signer, which additionally requests and embeds an RFC 3161 timestamp
+// token over the signature value from tsa. Validate verifies that embedded token's
+// signature chains to roots; pass nil only if the caller intends to trust any
+// self-consistent token regardless of who issued it, which disables certificate
+// verification entirely (see TSAClient.Validate).
+func NewAdobeCAdESDetachedWithTSA(signer model.Signer, tsa *TSAClient, roots *x509.CertPool) (model.SignatureHandler, error) {
+	if tsa == nil {
+		return nil, errors.New("sighandler: tsa must not be nil")
+	}
+	handler := &adobeCAdESDetachedTSA{signer: signer, tsa: tsa, tsaRoots: roots}
+	if signer != nil {
+		handler.certificate = signer.Certificate()
+	}
+	return handler, nil
+}
+
+// InitSignature initialises the PdfSignature.
+func (a *adobeCAdESDetachedTSA) InitSignature(sig *model.PdfSignature) error {
+	if !a.emptySignature {
+		if a.certificate == nil {
+			return errors.New("certificate must not be nil")
+		}
+		if a.signer == nil {
+			return errors.New("signer must not be nil")
+		}
+	}
+
+	handler := *a
+	sig.Handler = &handler
+	sig.Filter = core.MakeName("Adobe.PPKLite")
+	sig.SubFilter = core.MakeName("ETSI.CAdES.detached")
+	sig.Reference = nil
+
+	digest, err := handler.NewDigest(sig)
+	if err != nil {
+		return err
+	}
+	digest.Write([]byte("calculate the Contents field size"))
+	return handler.Sign(sig, digest)
+}
+
+// NewDigest creates a new digest.
+func (a *adobeCAdESDetachedTSA) NewDigest(sig *model.PdfSignature) (model.Hasher, error) {
+	return bytes.NewBuffer(nil), nil
+}
+
+// Validate validates PdfSignature, including the embedded RFC 3161 timestamp token.
+func (a *adobeCAdESDetachedTSA) Validate(sig *model.PdfSignature, digest model.Hasher) (model.SignatureValidationResult, error) {
+	signed := sig.Contents.Bytes()
+	p7, err := pkcs7.Parse(signed)
+	if err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	buffer := digest.(*bytes.Buffer)
+	p7.Content = buffer.Bytes()
+	if err = p7.Verify(); err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+	if len(p7.Signers) == 0 {
+		return model.SignatureValidationResult{}, errors.New("sighandler: no signers found")
+	}
+
+	token, err := extractTimestampToken(p7)
+	if err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+	if err := a.tsa.Validate(token, p7.Signers[0].EncryptedDigest, a.tsaRoots); err != nil {
+		return model.SignatureValidationResult{}, err
+	}
+
+	return model.SignatureValidationResult{
+		IsSigned:   true,
+		IsVerified: true,
+	}, nil
+}
+
+// extractTimestampToken returns the DER encoded TimeStampToken embedded in the first
+// signer of p7 as an id-aa-signatureTimeStampToken unsigned attribute.
+func extractTimestampToken(p7 *pkcs7.PKCS7) ([]byte, error) {
+	for _, attr := range p7.Signers[0].UnauthenticatedAttributes {
+		if attr.Type.Equal(oidSignatureTimeStampToken) {
+			return attr.Value.Bytes, nil
+		}
+	}
+	return nil, errors.New("sighandler: missing signatureTimeStampToken attribute")
+}
+
+// Sign sets the Contents field, embedding an RFC 3161 timestamp token over the signature.
+func (a *adobeCAdESDetachedTSA) Sign(sig *model.PdfSignature, digest model.Hasher) error {
+	if a.emptySignature {
+		sigLen := a.emptySignatureLen
+		if sigLen <= 0 {
+			sigLen = 8192
+		}
+
+		sig.Contents = core.MakeHexString(string(make([]byte, sigLen)))
+		return nil
+	}
+
+	buffer := digest.(*bytes.Buffer)
+	signedData, err := pkcs7.NewSignedData(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := signedData.AddSignerChain(a.certificate, a.signer, a.signer.Chain(), pkcs7.SignerInfoConfig{}); err != nil {
+		return err
+	}
+
+	signerInfos := signedData.GetSignedData().SignerInfos
+	encryptedDigest := signerInfos[len(signerInfos)-1].EncryptedDigest
+
+	token, err := a.tsa.Timestamp(encryptedDigest)
+	if err != nil {
+		return fmt.Errorf("sighandler: requesting timestamp token: %w", err)
+	}
+	tsAttr := pkcs7.Attribute{Type: oidSignatureTimeStampToken, Value: asn1.RawValue{FullBytes: token}}
+	if err := signerInfos[len(signerInfos)-1].SetUnauthenticatedAttributes([]pkcs7.Attribute{tsAttr}); err != nil {
+		return fmt.Errorf("sighandler: embedding timestamp token: %w", err)
+	}
+
+	signedData.Detach()
+	detachedSignature, err := signedData.Finish()
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 8192*2+2)
+	if len(detachedSignature) > len(data) {
+		return fmt.Errorf("sighandler: signature with embedded timestamp token is %d bytes, exceeds the %d byte Contents reservation", len(detachedSignature), len(data))
+	}
+	copy(data, detachedSignature)
+
+	sig.Contents = core.MakeHexString(string(data))
+	return nil
+}
+
+// IsApplicable returns true if the signature handler is applicable for the PdfSignature.
+// Besides the Filter/SubFilter pair it shares with the other CAdES.detached handlers in
+// this package, this handler is only recognised by the presence of its
+// signatureTimeStampToken unsigned attribute; without this check a plain approval
+// signature handler registered ahead of this one would validate it while silently skipping
+// the embedded timestamp check.
+func (a *adobeCAdESDetachedTSA) IsApplicable(sig *model.PdfSignature) bool {
+	if sig == nil || sig.Filter == nil || sig.SubFilter == nil {
+		return false
+	}
+	if !((*sig.Filter == "Adobe.PPKMS" || *sig.Filter == "Adobe.PPKLite") && *sig.SubFilter == "ETSI.CAdES.detached") {
+		return false
+	}
+	return hasUnauthenticatedAttribute(sig, oidSignatureTimeStampToken)
+}
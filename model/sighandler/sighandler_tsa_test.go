@@ -0,0 +1,253 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package sighandler
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+
+	"github.com/xwc1125/gopdf/model"
+	"github.com/xwc1125/gopdf/model/signer"
+)
+
+// oidContentTypeTSTInfo is id-ct-TSTInfo (RFC 3161, 2.4.2), the CMS content type carried by
+// a TimeStampToken's encapsulated content.
+var oidContentTypeTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+
+// signTimestampToken builds a DER encoded RFC 3161 TimeStampToken covering imprint (the
+// message imprint to echo back), signed by tsaKey/tsaCert, standing in for a real TSA's
+// response in tests.
+func signTimestampToken(t *testing.T, tsaCert *x509.Certificate, tsaKey *rsa.PrivateKey, hashOID asn1.ObjectIdentifier, imprint []byte) []byte {
+	t.Helper()
+
+	genTime, err := asn1.MarshalWithParams(time.Now().UTC(), "generalized")
+	if err != nil {
+		t.Fatalf("marshalling GenTime: %v", err)
+	}
+	info := tstInfo{
+		Version: 1,
+		Policy:  asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: hashOID},
+			HashedMessage: imprint,
+		},
+		SerialNumber: big.NewInt(1),
+		GenTime:      asn1.RawValue{FullBytes: genTime},
+	}
+	infoDER, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatalf("marshalling TSTInfo: %v", err)
+	}
+
+	signedData, err := pkcs7.NewSignedData(infoDER)
+	if err != nil {
+		t.Fatalf("pkcs7.NewSignedData: %v", err)
+	}
+	signedData.SetContentType(oidContentTypeTSTInfo)
+	signedData.SetDigestAlgorithm(hashOID)
+	if err := signedData.AddSignerChain(tsaCert, tsaKey, nil, pkcs7.SignerInfoConfig{}); err != nil {
+		t.Fatalf("AddSignerChain: %v", err)
+	}
+	token, err := signedData.Finish()
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	return token
+}
+
+// newFakeTSA starts an httptest.Server implementing enough of RFC 3161 to answer
+// TSAClient.Timestamp: it parses the incoming TimeStampReq and echoes its message imprint
+// back into a freshly signed TimeStampToken. The returned CertPool holds the self-signed
+// TSA certificate as a trusted root.
+func newFakeTSA(t *testing.T) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+
+	tsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating TSA key: %v", err)
+	}
+	tsaCert := selfSignedCert(t, &tsaKey.PublicKey, tsaKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req timeStampReq
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token := signTimestampToken(t, tsaCert, tsaKey, req.MessageImprint.HashAlgorithm.Algorithm, req.MessageImprint.HashedMessage)
+		resp := timeStampResp{
+			Status:         pkiStatusInfo{Status: 0},
+			TimeStampToken: asn1.RawValue{FullBytes: token},
+		}
+		respDER, err := asn1.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(respDER)
+	}))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tsaCert)
+	return server, roots
+}
+
+func TestTSAClientTimestampAndValidate(t *testing.T) {
+	server, roots := newFakeTSA(t)
+	defer server.Close()
+
+	client := NewTSAClient(server.URL)
+	signatureValue := []byte("a CMS signature value to be timestamped")
+
+	token, err := client.Timestamp(signatureValue)
+	if err != nil {
+		t.Fatalf("Timestamp: %v", err)
+	}
+	if err := client.Validate(token, signatureValue, roots); err != nil {
+		t.Errorf("Validate rejected a token from a trusted TSA: %v", err)
+	}
+}
+
+func TestTSAClientValidateRejectsUntrustedTSA(t *testing.T) {
+	server, _ := newFakeTSA(t)
+	defer server.Close()
+
+	client := NewTSAClient(server.URL)
+	token, err := client.Timestamp([]byte("a CMS signature value to be timestamped"))
+	if err != nil {
+		t.Fatalf("Timestamp: %v", err)
+	}
+
+	if err := client.Validate(token, []byte("a CMS signature value to be timestamped"), x509.NewCertPool()); err == nil {
+		t.Error("Validate did not reject a token chaining to no trusted root")
+	}
+}
+
+func TestTSAClientValidateRejectsMismatchedImprint(t *testing.T) {
+	server, roots := newFakeTSA(t)
+	defer server.Close()
+
+	client := NewTSAClient(server.URL)
+	token, err := client.Timestamp([]byte("the original signature value"))
+	if err != nil {
+		t.Fatalf("Timestamp: %v", err)
+	}
+
+	if err := client.Validate(token, []byte("a different signature value"), roots); err == nil {
+		t.Error("Validate did not reject a token whose message imprint does not match")
+	}
+}
+
+func TestAdobeCAdESDetachedTSASignAndValidate(t *testing.T) {
+	server, roots := newFakeTSA(t)
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	cert := selfSignedCert(t, &key.PublicKey, key)
+
+	handler, err := NewAdobeCAdESDetachedWithTSA(signer.NewKMSSigner(key, cert, nil), NewTSAClient(server.URL), roots)
+	if err != nil {
+		t.Fatalf("NewAdobeCAdESDetachedWithTSA: %v", err)
+	}
+	signAndValidate(t, handler)
+}
+
+func TestDocTimeStampSignAndValidate(t *testing.T) {
+	tsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating TSA key: %v", err)
+	}
+	tsaCert := selfSignedCert(t, &tsaKey.PublicKey, tsaKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(tsaCert)
+
+	documentBytes := []byte("the /ByteRange-covered bytes of the document being timestamped")
+	h := crypto.SHA256.New()
+	h.Write(documentBytes)
+	token := signTimestampToken(t, tsaCert, tsaKey, pkcs7.OIDDigestAlgorithmSHA256, h.Sum(nil))
+
+	handler, err := NewDocTimeStamp(token, roots)
+	if err != nil {
+		t.Fatalf("NewDocTimeStamp: %v", err)
+	}
+
+	sig := &model.PdfSignature{}
+	if err := handler.InitSignature(sig); err != nil {
+		t.Fatalf("InitSignature: %v", err)
+	}
+	digest, err := sig.Handler.NewDigest(sig)
+	if err != nil {
+		t.Fatalf("NewDigest: %v", err)
+	}
+	digest.Write(documentBytes)
+	if err := sig.Handler.Sign(sig, digest); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	result, err := sig.Handler.Validate(sig, digest)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !result.IsSigned || !result.IsVerified {
+		t.Fatalf("Validate returned %+v, want IsSigned and IsVerified", result)
+	}
+}
+
+func TestDocTimeStampValidateRejectsTamperedDocument(t *testing.T) {
+	tsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating TSA key: %v", err)
+	}
+	tsaCert := selfSignedCert(t, &tsaKey.PublicKey, tsaKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(tsaCert)
+
+	documentBytes := []byte("the /ByteRange-covered bytes of the document being timestamped")
+	h := crypto.SHA256.New()
+	h.Write(documentBytes)
+	token := signTimestampToken(t, tsaCert, tsaKey, pkcs7.OIDDigestAlgorithmSHA256, h.Sum(nil))
+
+	handler, err := NewDocTimeStamp(token, roots)
+	if err != nil {
+		t.Fatalf("NewDocTimeStamp: %v", err)
+	}
+	sig := &model.PdfSignature{}
+	if err := handler.InitSignature(sig); err != nil {
+		t.Fatalf("InitSignature: %v", err)
+	}
+	digest, err := sig.Handler.NewDigest(sig)
+	if err != nil {
+		t.Fatalf("NewDigest: %v", err)
+	}
+	digest.Write([]byte("a different document entirely"))
+	if err := sig.Handler.Sign(sig, digest); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if _, err := sig.Handler.Validate(sig, digest); err == nil {
+		t.Error("Validate did not reject a token whose message imprint does not match the document")
+	}
+}
@@ -0,0 +1,26 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package model
+
+import (
+	"crypto"
+	"crypto/x509"
+)
+
+// Signer abstracts a private key together with its certificate and issuer chain, so that
+// sighandler handlers can be backed by a raw in-memory key, a PKCS#11 token, or a cloud
+// KMS/HSM key without change. Signer embeds crypto.Signer, so any crypto.Signer
+// implementation (e.g. crypto/tls, a PKCS#11 session key, a cloud KMS client) that also
+// provides its certificate and chain satisfies this interface.
+type Signer interface {
+	crypto.Signer
+
+	// Certificate returns the end-entity certificate associated with the signing key.
+	Certificate() *x509.Certificate
+	// Chain returns the certificates of the issuers of the end-entity certificate, in
+	// order, not including the end-entity certificate itself. It may be empty.
+	Chain() []*x509.Certificate
+}
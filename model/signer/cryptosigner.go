@@ -0,0 +1,57 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package signer
+
+import (
+	"crypto"
+	"crypto/x509"
+	"io"
+
+	"github.com/xwc1125/gopdf/model"
+)
+
+// cryptoSigner adapts an arbitrary crypto.Signer, such as the signer types returned by the
+// Google Cloud KMS, AWS KMS or Azure Key Vault client libraries, to model.Signer by pairing
+// it with the certificate and chain of the key it represents. The private key material
+// never leaves the KMS/HSM; Sign calls are forwarded to it as-is.
+type cryptoSigner struct {
+	signer crypto.Signer
+	cert   *x509.Certificate
+	chain  []*x509.Certificate
+}
+
+// NewKMSSigner wraps signer, which may be backed by any cloud KMS or HSM client that
+// implements crypto.Signer (for example cloud.google.com/go/kms's signer, or
+// github.com/aws/aws-sdk-go-v2/service/kms's equivalent), as a model.Signer. cert is the
+// certificate for signer's public key; chain holds its issuer certificates, in order.
+func NewKMSSigner(signer crypto.Signer, cert *x509.Certificate, chain []*x509.Certificate) model.Signer {
+	return &cryptoSigner{
+		signer: signer,
+		cert:   cert,
+		chain:  chain,
+	}
+}
+
+// Public returns the public key of the wrapped signer.
+func (s *cryptoSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+// Sign forwards digest to the wrapped signer, e.g. dispatching an Asymmetric Sign request
+// to a cloud KMS.
+func (s *cryptoSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+// Certificate returns the end-entity certificate.
+func (s *cryptoSigner) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Chain returns the issuer certificates of the end-entity certificate.
+func (s *cryptoSigner) Chain() []*x509.Certificate {
+	return s.chain
+}
@@ -0,0 +1,10 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+// Package signer provides implementations of model.Signer backed by a PEM file, an
+// arbitrary crypto.Signer (for example a cloud KMS/HSM client), and a PKCS#11 token, so
+// that sighandler handlers can sign with keys that never leave a file, an HSM, or a
+// managed key service.
+package signer
@@ -0,0 +1,142 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package signer
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/xwc1125/gopdf/model"
+)
+
+// fileSigner is a model.Signer backed by a PEM-encoded private key and certificate held
+// in memory or on disk.
+type fileSigner struct {
+	key   crypto.Signer
+	cert  *x509.Certificate
+	chain []*x509.Certificate
+}
+
+// NewFileSigner loads a model.Signer from PEM-encoded key and certificate data. keyPEM may
+// hold an RSA, ECDSA or Ed25519 private key in PKCS#1, PKCS#8 or SEC1 form; if it is
+// password-protected (RFC 1423), password decrypts it. certPEM must hold the end-entity
+// certificate followed by zero or more issuer certificates, which become the chain.
+func NewFileSigner(keyPEM, certPEM []byte, password []byte) (model.Signer, error) {
+	key, err := parsePrivateKeyPEM(keyPEM, password)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parseCertificatesPEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("signer: no certificate found in certPEM")
+	}
+	return &fileSigner{
+		key:   key,
+		cert:  certs[0],
+		chain: certs[1:],
+	}, nil
+}
+
+// NewFileSignerFromFiles is a convenience wrapper around NewFileSigner that reads the key
+// and certificate PEM data from disk.
+func NewFileSignerFromFiles(keyPath, certPath string, password []byte) (model.Signer, error) {
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("signer: reading key file: %w", err)
+	}
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("signer: reading certificate file: %w", err)
+	}
+	return NewFileSigner(keyPEM, certPEM, password)
+}
+
+// Public returns the public key of the signer.
+func (s *fileSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+// Sign signs digest with the loaded private key.
+func (s *fileSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+// Certificate returns the end-entity certificate.
+func (s *fileSigner) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Chain returns the issuer certificates following the end-entity certificate in certPEM.
+func (s *fileSigner) Chain() []*x509.Certificate {
+	return s.chain
+}
+
+// parsePrivateKeyPEM decodes the first PEM block in data, which must hold the private key,
+// decrypting it with password first if it is RFC 1423 encrypted, and parses it as PKCS#1,
+// PKCS#8 or SEC1.
+func parsePrivateKeyPEM(data []byte, password []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signer: no PEM block found in key data")
+	}
+
+	der := block.Bytes
+	if x509.IsEncryptedPEMBlock(block) {
+		if len(password) == 0 {
+			return nil, errors.New("signer: private key is encrypted but no password was given")
+		}
+		decrypted, err := x509.DecryptPEMBlock(block, password)
+		if err != nil {
+			return nil, fmt.Errorf("signer: decrypting private key: %w", err)
+		}
+		der = decrypted
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("signer: unsupported or invalid private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("signer: private key does not implement crypto.Signer")
+	}
+	return signer, nil
+}
+
+// parseCertificatesPEM decodes every CERTIFICATE block in data, in order.
+func parseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("signer: parsing certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
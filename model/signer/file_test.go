@@ -0,0 +1,163 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// selfSignedCertPEM returns a self-signed certificate for pub/priv, PEM encoded.
+func selfSignedCertPEM(t *testing.T, pub *rsa.PublicKey, priv *rsa.PrivateKey) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "file signer test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestNewFileSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	certPEM := selfSignedCertPEM(t, &key.PublicKey, key)
+
+	s, err := NewFileSigner(keyPEM, certPEM, nil)
+	if err != nil {
+		t.Fatalf("NewFileSigner: %v", err)
+	}
+	if _, ok := s.Public().(*rsa.PublicKey); !ok {
+		t.Fatalf("Public() returned %T, want *rsa.PublicKey", s.Public())
+	}
+	if s.Certificate() == nil {
+		t.Fatal("Certificate() returned nil")
+	}
+	if len(s.Chain()) != 0 {
+		t.Errorf("Chain() = %d certs, want 0", len(s.Chain()))
+	}
+
+	digest := []byte("32-byte-digest-stand-in-value!!!")
+	sig, err := s.Sign(rand.Reader, digest, crypto.Hash(0))
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, 0, digest, sig); err != nil {
+		t.Errorf("signature produced by Sign does not verify: %v", err)
+	}
+}
+
+func TestNewFileSignerChain(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	issuerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating issuer RSA key: %v", err)
+	}
+
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "file signer test issuer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatalf("creating issuer certificate: %v", err)
+	}
+	issuerCert, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatalf("parsing issuer certificate: %v", err)
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "file signer test leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, issuerCert, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatalf("creating leaf certificate: %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	certPEM := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuerDER})...,
+	)
+
+	s, err := NewFileSigner(keyPEM, certPEM, nil)
+	if err != nil {
+		t.Fatalf("NewFileSigner: %v", err)
+	}
+	if len(s.Chain()) != 1 {
+		t.Fatalf("Chain() = %d certs, want 1", len(s.Chain()))
+	}
+	if s.Chain()[0].Subject.CommonName != "file signer test issuer" {
+		t.Errorf("Chain()[0] = %q, want the issuer certificate", s.Chain()[0].Subject.CommonName)
+	}
+}
+
+func TestNewFileSignerEncryptedKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	certPEM := selfSignedCertPEM(t, &key.PublicKey, key)
+
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte("hunter2"), x509.PEMCipherAES256) //nolint:staticcheck
+	if err != nil {
+		t.Fatalf("encrypting PEM block: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(block)
+
+	if _, err := NewFileSigner(keyPEM, certPEM, nil); err == nil {
+		t.Error("NewFileSigner did not reject an encrypted key with no password given")
+	}
+	if _, err := NewFileSigner(keyPEM, certPEM, []byte("wrong password")); err == nil {
+		t.Error("NewFileSigner did not reject an encrypted key with the wrong password")
+	}
+
+	s, err := NewFileSigner(keyPEM, certPEM, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("NewFileSigner with the correct password: %v", err)
+	}
+	if _, ok := s.Public().(*rsa.PublicKey); !ok {
+		t.Fatalf("Public() returned %T, want *rsa.PublicKey", s.Public())
+	}
+}
+
+func TestNewFileSignerNoCertificate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	if _, err := NewFileSigner(keyPEM, nil, nil); err == nil {
+		t.Error("NewFileSigner did not reject certPEM with no certificate")
+	}
+}
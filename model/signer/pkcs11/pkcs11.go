@@ -0,0 +1,454 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+// Package pkcs11 provides a model.Signer implementation backed by a PKCS#11 token (an
+// HSM or smart card), so that the private key material used to sign a PDF never leaves
+// the token. Keys are addressed with a pkcs11: URI (RFC 7512).
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+
+	"github.com/xwc1125/gopdf/model"
+)
+
+// pkcs1v15HashPrefix holds the ASN.1 DigestInfo prefix for each supported hash, as used by
+// RSASSA-PKCS1-v1_5 (RFC 8017, 9.2). PKCS#11's CKM_RSA_PKCS mechanism signs its input
+// as-is, so the caller (not the token) is responsible for prepending this prefix.
+var pkcs1v15HashPrefix = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// pssMechanismParams holds the CKM_RSA_PKCS_PSS mechanism's own digest mechanism and MGF1
+// mask-generation function for a given hash algorithm (PKCS#11 2.40, 2.3.4). The token
+// hashes nothing itself here - digest is already hashed by the caller, same as CKM_RSA_PKCS
+// - these two fields only tell the token which hash/MGF to assume when forming and masking
+// the PSS padding.
+var pssMechanismParams = map[crypto.Hash]struct{ hashAlg, mgf uint }{
+	crypto.SHA1:   {pkcs11.CKM_SHA_1, pkcs11.CKG_MGF1_SHA1},
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+// Signer is a model.Signer backed by a private key held in a PKCS#11 token.
+type Signer struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	keyType uint
+
+	public crypto.PublicKey
+	cert   *x509.Certificate
+	chain  []*x509.Certificate
+}
+
+// Open opens the PKCS#11 module and session identified by uri, a pkcs11: URI as defined
+// in RFC 7512, and returns a model.Signer for the private key it addresses.
+//
+// uri must set "module-path" to the PKCS#11 module (.so) to load. The token is selected by
+// its "token" label (without it, the first slot with a token present is used), and
+// "pin-value", if set, is used to log in; "slot-id" and "pin-source" are not read. The key
+// object itself is addressed by "object" (CKA_LABEL) and/or "id" (CKA_ID), e.g.:
+//
+//	pkcs11:token=MyToken;object=signing-key;id=%01?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234
+//
+// certPEM, if non-empty, supplies the end-entity certificate and chain for the key; if
+// empty, Open looks for a matching CKO_CERTIFICATE object on the token instead.
+func Open(uri string, certPEM []byte) (model.Signer, error) {
+	attrs, err := parseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if attrs.modulePath == "" {
+		return nil, errors.New("pkcs11: uri is missing the module-path query attribute")
+	}
+
+	ctx := pkcs11.New(attrs.modulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11: failed to load module %q", attrs.modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: initializing module: %w", err)
+	}
+
+	slot, err := findSlot(ctx, attrs)
+	if err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: opening session: %w", err)
+	}
+	if attrs.pin != "" {
+		if err := ctx.Login(session, pkcs11.CKU_USER, attrs.pin); err != nil {
+			ctx.CloseSession(session)
+			ctx.Destroy()
+			return nil, fmt.Errorf("pkcs11: login: %w", err)
+		}
+	}
+
+	key, err := findObject(ctx, session, pkcs11.CKO_PRIVATE_KEY, attrs)
+	if err != nil {
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return nil, err
+	}
+
+	public, keyType, err := publicKeyOf(ctx, session, attrs)
+	if err != nil {
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	if len(certPEM) > 0 {
+		certs, err = parseCertificatesPEM(certPEM)
+	} else {
+		certs, err = certificatesFromToken(ctx, session, attrs)
+	}
+	if err != nil {
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return nil, err
+	}
+	if len(certs) == 0 {
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return nil, errors.New("pkcs11: no certificate found for key, pass certPEM or store a matching CKO_CERTIFICATE object")
+	}
+
+	return &Signer{
+		ctx:     ctx,
+		session: session,
+		key:     key,
+		keyType: keyType,
+		public:  public,
+		cert:    certs[0],
+		chain:   certs[1:],
+	}, nil
+}
+
+// Close logs out, closes the session and unloads the PKCS#11 module.
+func (s *Signer) Close() error {
+	s.ctx.Logout(s.session)
+	s.ctx.CloseSession(s.session)
+	err := s.ctx.Finalize()
+	s.ctx.Destroy()
+	return err
+}
+
+// Public returns the public key of the signing key.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Certificate returns the end-entity certificate.
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Chain returns the issuer certificates of the end-entity certificate.
+func (s *Signer) Chain() []*x509.Certificate {
+	return s.chain
+}
+
+// Sign signs digest, which must already be hashed with the algorithm described by opts,
+// using the token's C_Sign.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	switch s.keyType {
+	case pkcs11.CKK_EC:
+		return s.signECDSA(digest)
+	case pkcs11.CKK_RSA:
+		return s.signRSA(digest, opts)
+	default:
+		return nil, fmt.Errorf("pkcs11: unsupported key type %#x", s.keyType)
+	}
+}
+
+func (s *Signer) signECDSA(digest []byte) ([]byte, error) {
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}
+	if err := s.ctx.SignInit(s.session, mech, s.key); err != nil {
+		return nil, fmt.Errorf("pkcs11: SignInit: %w", err)
+	}
+	raw, err := s.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: Sign: %w", err)
+	}
+	// CKM_ECDSA returns the raw, fixed-length concatenation of r and s; crypto.Signer
+	// implementations for ECDSA keys are expected to return the ASN.1 DER encoding used by
+	// crypto/ecdsa, so re-encode it here.
+	half := len(raw) / 2
+	r := new(big.Int).SetBytes(raw[:half])
+	sVal := new(big.Int).SetBytes(raw[half:])
+	return asn1.Marshal(struct{ R, S *big.Int }{r, sVal})
+}
+
+func (s *Signer) signRSA(digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+		return s.signRSAPSS(digest, pssOpts)
+	}
+	prefix, ok := pkcs1v15HashPrefix[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: unsupported hash %v for RSA PKCS#1 v1.5 signing", opts.HashFunc())
+	}
+	digestInfo := append(append([]byte{}, prefix...), digest...)
+
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}
+	if err := s.ctx.SignInit(s.session, mech, s.key); err != nil {
+		return nil, fmt.Errorf("pkcs11: SignInit: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, digestInfo)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: Sign: %w", err)
+	}
+	return sig, nil
+}
+
+// signRSAPSS signs the already-hashed digest with the token's CKM_RSA_PKCS_PSS mechanism,
+// which (like CKM_RSA_PKCS) expects a pre-hashed input; the mechanism's hashAlg/mgf
+// parameters only tell the token which hash/MGF1 to assume when it forms and masks the PSS
+// padding itself. A non-positive opts.SaltLength (the rsa.PSSSaltLengthAuto/
+// rsa.PSSSaltLengthEqualsHash sentinels) is resolved to the hash's own size, matching the
+// default salt length of model/sighandler's RSA-PSS handler.
+func (s *Signer) signRSAPSS(digest []byte, opts *rsa.PSSOptions) ([]byte, error) {
+	params, ok := pssMechanismParams[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("pkcs11: unsupported hash %v for RSA-PSS signing", opts.HashFunc())
+	}
+	saltLength := opts.SaltLength
+	if saltLength <= 0 {
+		saltLength = opts.HashFunc().Size()
+	}
+
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, pkcs11.NewPSSParams(params.hashAlg, params.mgf, uint(saltLength)))}
+	if err := s.ctx.SignInit(s.session, mech, s.key); err != nil {
+		return nil, fmt.Errorf("pkcs11: SignInit: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, digest)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: Sign: %w", err)
+	}
+	return sig, nil
+}
+
+// uriAttrs holds the PKCS#11 URI components relevant to locating a token and an object on
+// it (RFC 7512).
+type uriAttrs struct {
+	modulePath string
+	pin        string
+	token      string
+	object     string
+	id         []byte
+}
+
+func parseURI(uri string) (*uriAttrs, error) {
+	if !strings.HasPrefix(uri, "pkcs11:") {
+		return nil, fmt.Errorf("pkcs11: not a pkcs11: uri: %q", uri)
+	}
+	rest := strings.TrimPrefix(uri, "pkcs11:")
+	path := rest
+	var query string
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		path, query = rest[:i], rest[i+1:]
+	}
+
+	attrs := &uriAttrs{}
+	if err := parseComponents(path, func(k, v string) error {
+		switch k {
+		case "token":
+			attrs.token = v
+		case "object":
+			attrs.object = v
+		case "id":
+			id, err := url.PathUnescape(v)
+			if err != nil {
+				return fmt.Errorf("pkcs11: invalid id component: %w", err)
+			}
+			attrs.id = []byte(id)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := parseComponents(query, func(k, v string) error {
+		switch k {
+		case "module-path":
+			attrs.modulePath = v
+		case "pin-value":
+			attrs.pin = v
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+func parseComponents(s string, set func(k, v string) error) error {
+	if s == "" {
+		return nil
+	}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		for _, amp := range strings.Split(part, "&") {
+			kv := strings.SplitN(amp, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("pkcs11: malformed uri component %q", amp)
+			}
+			if err := set(kv[0], kv[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func findSlot(ctx *pkcs11.Ctx, attrs *uriAttrs) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: listing slots: %w", err)
+	}
+	if attrs.token == "" {
+		if len(slots) == 0 {
+			return 0, errors.New("pkcs11: no slots with a token present")
+		}
+		return slots[0], nil
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if strings.TrimRight(info.Label, "\x00 ") == attrs.token {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("pkcs11: no slot found for token %q", attrs.token)
+}
+
+func findObject(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, attrs *uriAttrs) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if attrs.object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, attrs.object))
+	}
+	if len(attrs.id) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, attrs.id))
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("pkcs11: FindObjectsInit: %w", err)
+	}
+	defer ctx.FindObjectsFinal(session)
+
+	objs, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: FindObjects: %w", err)
+	}
+	if len(objs) == 0 {
+		return 0, errors.New("pkcs11: no matching object found on token")
+	}
+	return objs[0], nil
+}
+
+func publicKeyOf(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, attrs *uriAttrs) (crypto.PublicKey, uint, error) {
+	handle, err := findObject(ctx, session, pkcs11.CKO_PUBLIC_KEY, attrs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	values, err := ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("pkcs11: GetAttributeValue: %w", err)
+	}
+	keyType := new(big.Int).SetBytes(values[0].Value).Uint64()
+
+	switch uint(keyType) {
+	case pkcs11.CKK_RSA:
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(values[1].Value),
+			E: int(new(big.Int).SetBytes(values[2].Value).Int64()),
+		}, pkcs11.CKK_RSA, nil
+	case pkcs11.CKK_EC:
+		var ecPoint asn1.RawValue
+		if _, err := asn1.Unmarshal(values[3].Value, &ecPoint); err != nil {
+			return nil, 0, fmt.Errorf("pkcs11: decoding CKA_EC_POINT: %w", err)
+		}
+		x, y := elliptic.Unmarshal(elliptic.P256(), ecPoint.Bytes)
+		if x == nil {
+			return nil, 0, errors.New("pkcs11: unsupported EC point encoding, only uncompressed P-256 points are supported")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, pkcs11.CKK_EC, nil
+	default:
+		return nil, 0, fmt.Errorf("pkcs11: unsupported CKA_KEY_TYPE %#x", keyType)
+	}
+}
+
+// parseCertificatesPEM decodes every CERTIFICATE block in data, in order.
+func parseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("pkcs11: parsing certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+func certificatesFromToken(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, attrs *uriAttrs) ([]*x509.Certificate, error) {
+	handle, err := findObject(ctx, session, pkcs11.CKO_CERTIFICATE, attrs)
+	if err != nil {
+		return nil, nil
+	}
+	values, err := ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: GetAttributeValue(CKA_VALUE): %w", err)
+	}
+	cert, err := x509.ParseCertificate(values[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: parsing CKA_VALUE as certificate: %w", err)
+	}
+	return []*x509.Certificate{cert}, nil
+}
@@ -0,0 +1,65 @@
+/*
+ * This file is subject to the terms and conditions defined in
+ * file 'LICENSE.md', which is part of this source code package.
+ */
+
+package pkcs11
+
+import "testing"
+
+func TestParseURI(t *testing.T) {
+	uri := "pkcs11:token=MyToken;object=signing-key;id=%01?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234"
+	attrs, err := parseURI(uri)
+	if err != nil {
+		t.Fatalf("parseURI: %v", err)
+	}
+	if attrs.token != "MyToken" {
+		t.Errorf("token = %q, want %q", attrs.token, "MyToken")
+	}
+	if attrs.object != "signing-key" {
+		t.Errorf("object = %q, want %q", attrs.object, "signing-key")
+	}
+	if string(attrs.id) != "\x01" {
+		t.Errorf("id = %q, want %q", attrs.id, "\x01")
+	}
+	if attrs.modulePath != "/usr/lib/softhsm/libsofthsm2.so" {
+		t.Errorf("modulePath = %q, want %q", attrs.modulePath, "/usr/lib/softhsm/libsofthsm2.so")
+	}
+	if attrs.pin != "1234" {
+		t.Errorf("pin = %q, want %q", attrs.pin, "1234")
+	}
+}
+
+func TestParseURINoQuery(t *testing.T) {
+	attrs, err := parseURI("pkcs11:token=MyToken;object=signing-key")
+	if err != nil {
+		t.Fatalf("parseURI: %v", err)
+	}
+	if attrs.token != "MyToken" || attrs.object != "signing-key" {
+		t.Errorf("attrs = %+v, want token=MyToken object=signing-key", attrs)
+	}
+	if attrs.modulePath != "" {
+		t.Errorf("modulePath = %q, want empty", attrs.modulePath)
+	}
+}
+
+func TestParseURIRejectsNonPKCS11Scheme(t *testing.T) {
+	if _, err := parseURI("https://example.com"); err == nil {
+		t.Error("parseURI did not reject a non-pkcs11 URI")
+	}
+}
+
+func TestParseURIRejectsMalformedComponent(t *testing.T) {
+	if _, err := parseURI("pkcs11:token"); err == nil {
+		t.Error("parseURI did not reject a path component with no value")
+	}
+	if _, err := parseURI("pkcs11:?module-path"); err == nil {
+		t.Error("parseURI did not reject a query component with no value")
+	}
+}
+
+func TestParseURIRejectsInvalidIDEscape(t *testing.T) {
+	if _, err := parseURI("pkcs11:id=%zz"); err == nil {
+		t.Error("parseURI did not reject an invalid percent-escape in id")
+	}
+}